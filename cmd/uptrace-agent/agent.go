@@ -0,0 +1,381 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/uptrace/uptrace-go/internal/otlpjson"
+	"github.com/uptrace/uptrace-go/internal/otlpproto"
+	"github.com/uptrace/uptrace-go/uptrace"
+)
+
+const (
+	maxRequestSize = 64 << 20
+	forwardRetries = 5
+)
+
+var (
+	errQueueFull   = errors.New("queue is full")
+	errAgentClosed = errors.New("agent is closed")
+)
+
+type otlpExporter interface {
+	ExportOTLP(ctx context.Context, signal uptrace.Signal, body []byte) error
+}
+
+type agentRequest struct {
+	signal uptrace.Signal
+	body   []byte
+}
+
+// agent receives OTLP requests, adds the host resource attributes,
+// and forwards the requests to Uptrace using a bounded in-memory queue.
+type agent struct {
+	exporter otlpExporter
+	resource []*commonpb.KeyValue
+	logger   *log.Logger
+
+	// mu guards closed and prevents the receivers from sending to the closed queue.
+	mu     sync.RWMutex
+	closed bool
+	queue  chan agentRequest
+	wg     sync.WaitGroup
+
+	// ctx is canceled when the close timeout expires to abort the exports in progress.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// closing is closed on shutdown to stop retrying failed requests.
+	closing chan struct{}
+}
+
+func newAgent(
+	exporter otlpExporter, resource []*commonpb.KeyValue, queueSize int, logger *log.Logger,
+) *agent {
+	a := &agent{
+		exporter: exporter,
+		resource: resource,
+		logger:   logger,
+		queue:    make(chan agentRequest, queueSize),
+		closing:  make(chan struct{}),
+	}
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+	return a
+}
+
+// start starts the workers that forward the queued requests.
+func (a *agent) start(workers int) {
+	for i := 0; i < workers; i++ {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			for req := range a.queue {
+				a.forward(req)
+			}
+		}()
+	}
+}
+
+// close forwards the queued requests without retrying and stops the workers.
+// When ctx is done, the exports in progress are canceled. The requests
+// received after close are rejected.
+func (a *agent) close(ctx context.Context) error {
+	a.mu.Lock()
+	a.closed = true
+	close(a.closing)
+	close(a.queue)
+	a.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		a.cancel()
+		return nil
+	case <-ctx.Done():
+		a.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// enqueue adds the host resource attributes to the request and queues it.
+func (a *agent) enqueue(signal uptrace.Signal, msg proto.Message) error {
+	a.enrich(msg)
+
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return errAgentClosed
+	}
+	select {
+	case a.queue <- agentRequest{signal: signal, body: body}:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// isUnavailable reports whether the request can be retried later.
+func isUnavailable(err error) bool {
+	return errors.Is(err, errQueueFull) || errors.Is(err, errAgentClosed)
+}
+
+func (a *agent) forward(req agentRequest) {
+	for attempt := 1; ; attempt++ {
+		err := a.exporter.ExportOTLP(a.ctx, req.signal, req.body)
+		if err == nil {
+			return
+		}
+		if errors.Is(err, uptrace.ErrDSNRejected) || attempt >= forwardRetries {
+			a.logger.Printf("dropping %s: %s", req.signal, err)
+			return
+		}
+
+		timer := time.NewTimer(time.Duration(attempt) * time.Second)
+		select {
+		case <-timer.C:
+		case <-a.closing:
+			timer.Stop()
+			a.logger.Printf("dropping %s: %s", req.signal, err)
+			return
+		}
+	}
+}
+
+// enrich adds the host resource attributes that are not set by the application.
+func (a *agent) enrich(msg proto.Message) {
+	switch msg := msg.(type) {
+	case *collectortrace.ExportTraceServiceRequest:
+		for _, rs := range msg.ResourceSpans {
+			rs.Resource = a.mergeResource(rs.Resource)
+		}
+	case *collectormetrics.ExportMetricsServiceRequest:
+		for _, rm := range msg.ResourceMetrics {
+			rm.Resource = a.mergeResource(rm.Resource)
+		}
+	case *collectorlogs.ExportLogsServiceRequest:
+		for _, rl := range msg.ResourceLogs {
+			rl.Resource = a.mergeResource(rl.Resource)
+		}
+	}
+}
+
+func (a *agent) mergeResource(res *resourcepb.Resource) *resourcepb.Resource {
+	if res == nil {
+		res = new(resourcepb.Resource)
+	}
+
+	keys := make(map[string]struct{}, len(res.Attributes))
+	for _, kv := range res.Attributes {
+		keys[kv.Key] = struct{}{}
+	}
+	for _, kv := range a.resource {
+		if _, ok := keys[kv.Key]; !ok {
+			res.Attributes = append(res.Attributes, kv)
+		}
+	}
+	return res
+}
+
+//------------------------------------------------------------------------------
+
+// ServeHTTP implements the OTLP/HTTP receiver accepting protobuf and JSON requests.
+func (a *agent) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var signal uptrace.Signal
+	switch req.URL.Path {
+	case "/v1/traces":
+		signal = uptrace.SignalTraces
+	case "/v1/metrics":
+		signal = uptrace.SignalMetrics
+	case "/v1/logs":
+		signal = uptrace.SignalLogs
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body io.Reader = http.MaxBytesReader(w, req.Body, maxRequestSize)
+	if req.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Read one byte past the limit to detect the large requests.
+		body = io.LimitReader(zr, maxRequestSize+1)
+	}
+
+	b, err := io.ReadAll(body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(b) > maxRequestSize {
+		http.Error(w, "decompressed request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	isJSON := strings.HasPrefix(req.Header.Get("Content-Type"), "application/json")
+	msg := otlpproto.NewExportRequest(string(signal))
+	if isJSON {
+		err = otlpjson.Unmarshal(b, msg)
+	} else {
+		err = proto.Unmarshal(b, msg)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.enqueue(signal, msg); err != nil {
+		if isUnavailable(err) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The response is an empty export response message.
+	if isJSON {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, "{}")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+//------------------------------------------------------------------------------
+
+// registerGRPC registers the OTLP/gRPC receiver.
+func (a *agent) registerGRPC(srv *grpc.Server) {
+	collectortrace.RegisterTraceServiceServer(srv, &traceService{agent: a})
+	collectormetrics.RegisterMetricsServiceServer(srv, &metricsService{agent: a})
+	collectorlogs.RegisterLogsServiceServer(srv, &logsService{agent: a})
+}
+
+func (a *agent) grpcError(err error) error {
+	if isUnavailable(err) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+type traceService struct {
+	collectortrace.UnimplementedTraceServiceServer
+	agent *agent
+}
+
+func (s *traceService) Export(
+	ctx context.Context, req *collectortrace.ExportTraceServiceRequest,
+) (*collectortrace.ExportTraceServiceResponse, error) {
+	if err := s.agent.enqueue(uptrace.SignalTraces, req); err != nil {
+		return nil, s.agent.grpcError(err)
+	}
+	return new(collectortrace.ExportTraceServiceResponse), nil
+}
+
+type metricsService struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+	agent *agent
+}
+
+func (s *metricsService) Export(
+	ctx context.Context, req *collectormetrics.ExportMetricsServiceRequest,
+) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	if err := s.agent.enqueue(uptrace.SignalMetrics, req); err != nil {
+		return nil, s.agent.grpcError(err)
+	}
+	return new(collectormetrics.ExportMetricsServiceResponse), nil
+}
+
+type logsService struct {
+	collectorlogs.UnimplementedLogsServiceServer
+	agent *agent
+}
+
+func (s *logsService) Export(
+	ctx context.Context, req *collectorlogs.ExportLogsServiceRequest,
+) (*collectorlogs.ExportLogsServiceResponse, error) {
+	if err := s.agent.enqueue(uptrace.SignalLogs, req); err != nil {
+		return nil, s.agent.grpcError(err)
+	}
+	return new(collectorlogs.ExportLogsServiceResponse), nil
+}
+
+//------------------------------------------------------------------------------
+
+// otlpAttributes converts the attributes to OTLP key-values.
+func otlpAttributes(attrs []attribute.KeyValue) []*commonpb.KeyValue {
+	kvs := make([]*commonpb.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		kvs = append(kvs, &commonpb.KeyValue{
+			Key:   string(attr.Key),
+			Value: otlpValue(attr.Value),
+		})
+	}
+	return kvs
+}
+
+func otlpValue(v attribute.Value) *commonpb.AnyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.AsBool()}}
+	case attribute.INT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.AsInt64()}}
+	case attribute.FLOAT64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.AsFloat64()}}
+	case attribute.STRINGSLICE:
+		values := make([]*commonpb.AnyValue, 0, len(v.AsStringSlice()))
+		for _, s := range v.AsStringSlice() {
+			values = append(values, &commonpb.AnyValue{
+				Value: &commonpb.AnyValue_StringValue{StringValue: s},
+			})
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{
+			ArrayValue: &commonpb.ArrayValue{Values: values},
+		}}
+	default:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Emit()}}
+	}
+}
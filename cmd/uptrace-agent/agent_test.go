@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/uptrace/uptrace-go/internal/otlpjson"
+	"github.com/uptrace/uptrace-go/uptrace"
+)
+
+type forwarded struct {
+	signal uptrace.Signal
+	body   []byte
+}
+
+type fakeExporter struct {
+	ch chan forwarded
+}
+
+func (e *fakeExporter) ExportOTLP(ctx context.Context, signal uptrace.Signal, body []byte) error {
+	e.ch <- forwarded{signal: signal, body: body}
+	return nil
+}
+
+func newTestAgent(queueSize int) (*agent, *fakeExporter) {
+	exporter := &fakeExporter{ch: make(chan forwarded, 10)}
+	resource := otlpAttributes([]attribute.KeyValue{
+		attribute.String("host.name", "agent-host"),
+		attribute.String("os.type", "linux"),
+	})
+	return newAgent(exporter, resource, queueSize, log.New(io.Discard, "", 0)), exporter
+}
+
+func newTraceRequest() *collectortrace.ExportTraceServiceRequest {
+	return &collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: &resourcepb.Resource{
+				Attributes: otlpAttributes([]attribute.KeyValue{
+					attribute.String("service.name", "app"),
+					attribute.String("host.name", "app-host"),
+				}),
+			},
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Spans: []*tracepb.Span{{
+					TraceId: []byte("0123456789abcdef"),
+					SpanId:  []byte("01234567"),
+					Name:    "hello",
+				}},
+			}},
+		}},
+	}
+}
+
+func resourceAttrs(t *testing.T, fwd forwarded) map[string]string {
+	require.Equal(t, uptrace.SignalTraces, fwd.signal)
+
+	msg := new(collectortrace.ExportTraceServiceRequest)
+	require.NoError(t, proto.Unmarshal(fwd.body, msg))
+
+	attrs := make(map[string]string)
+	for _, kv := range msg.ResourceSpans[0].Resource.Attributes {
+		attrs[kv.Key] = kv.Value.GetStringValue()
+	}
+	return attrs
+}
+
+func TestAgentHTTP(t *testing.T) {
+	agent, exporter := newTestAgent(10)
+	agent.start(1)
+	defer agent.close(context.Background())
+
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+
+	wantAttrs := map[string]string{
+		"service.name": "app",
+		"host.name":    "app-host",
+		"os.type":      "linux",
+	}
+
+	body, err := proto.Marshal(newTraceRequest())
+	require.NoError(t, err)
+	resp, err := http.Post(srv.URL+"/v1/traces", "application/x-protobuf", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, wantAttrs, resourceAttrs(t, <-exporter.ch))
+
+	body, err = otlpjson.Marshal(newTraceRequest())
+	require.NoError(t, err)
+	resp, err = http.Post(srv.URL+"/v1/traces", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "{}", string(respBody))
+	require.Equal(t, wantAttrs, resourceAttrs(t, <-exporter.ch))
+
+	resp, err = http.Post(srv.URL+"/v1/unknown", "application/x-protobuf", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestAgentQueueFull(t *testing.T) {
+	agent, _ := newTestAgent(1)
+
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+
+	body, err := proto.Marshal(newTraceRequest())
+	require.NoError(t, err)
+
+	resp, err := http.Post(srv.URL+"/v1/traces", "application/x-protobuf", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Post(srv.URL+"/v1/traces", "application/x-protobuf", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, "1", resp.Header.Get("Retry-After"))
+}
+
+func TestAgentGzipTooLarge(t *testing.T) {
+	agent, _ := newTestAgent(1)
+
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(make([]byte, maxRequestSize+1))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/traces", &buf)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
+func TestAgentEnqueueAfterClose(t *testing.T) {
+	agent, _ := newTestAgent(10)
+	agent.start(1)
+	require.NoError(t, agent.close(context.Background()))
+
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+
+	body, err := proto.Marshal(newTraceRequest())
+	require.NoError(t, err)
+
+	resp, err := http.Post(srv.URL+"/v1/traces", "application/x-protobuf", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestAgentGRPC(t *testing.T) {
+	ctx := context.Background()
+
+	agent, exporter := newTestAgent(10)
+	agent.start(1)
+	defer agent.close(ctx)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := grpc.NewServer()
+	agent.registerGRPC(srv)
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient(ln.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	req := newTraceRequest()
+	req.ResourceSpans[0].Resource.Attributes = []*commonpb.KeyValue{{
+		Key:   "service.name",
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "app"}},
+	}}
+
+	_, err = collectortrace.NewTraceServiceClient(conn).Export(ctx, req)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]string{
+		"service.name": "app",
+		"host.name":    "agent-host",
+		"os.type":      "linux",
+	}, resourceAttrs(t, <-exporter.ch))
+}
+
+type failingExporter struct {
+	attempts atomic.Int64
+}
+
+func (e *failingExporter) ExportOTLP(ctx context.Context, signal uptrace.Signal, body []byte) error {
+	e.attempts.Add(1)
+	return errors.New("unavailable")
+}
+
+func TestAgentCloseStopsRetrying(t *testing.T) {
+	exporter := new(failingExporter)
+	agent := newAgent(exporter, nil, 10, log.New(io.Discard, "", 0))
+	agent.start(1)
+
+	require.NoError(t, agent.enqueue(uptrace.SignalTraces, newTraceRequest()))
+	require.Eventually(t, func() bool {
+		return exporter.attempts.Load() == 1
+	}, time.Second, time.Millisecond)
+
+	start := time.Now()
+	require.NoError(t, agent.close(context.Background()))
+	require.Less(t, time.Since(start), time.Second)
+	require.Equal(t, int64(1), exporter.attempts.Load())
+}
+
+func TestHostAttributes(t *testing.T) {
+	res := resource.NewSchemaless(
+		attribute.String("host.name", "agent-host"),
+		attribute.String("telemetry.sdk.language", "go"),
+	)
+	attrs := hostAttributes(res)
+	require.Len(t, attrs, 1)
+	require.Equal(t, "host.name", attrs[0].Key)
+}
@@ -0,0 +1,178 @@
+// Command uptrace-agent receives OTLP data from local processes and forwards it to Uptrace.
+//
+// Applications export data to the agent without credentials, for example, using
+// OTEL_EXPORTER_OTLP_ENDPOINT=http://localhost:4318, and the agent adds the host
+// resource attributes and forwards the data to the DSN configured with UPTRACE_DSN,
+// UPTRACE_DSN_FILE, or UPTRACE_CONFIG_FILE.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip" // register the gzip decompressor
+
+	"github.com/uptrace/uptrace-go/uptrace"
+)
+
+var (
+	httpFlag = flag.String("http", "localhost:4318", "OTLP/HTTP listen address")
+	grpcFlag = flag.String("grpc", "",
+		"OTLP/gRPC listen address, for example, localhost:4317 (default is disabled)")
+	dsnFlag       = flag.String("dsn", "", "Uptrace DSN (default is UPTRACE_DSN env var)")
+	queueSizeFlag = flag.Int("queue-size", 1000, "max number of requests buffered in memory")
+	workersFlag   = flag.Int("workers", 4, "number of concurrent requests to Uptrace")
+	diskQueueFlag = flag.String("disk-queue", "",
+		"dir to buffer requests on disk when Uptrace is unavailable")
+	diskQueueSizeFlag = flag.Int64("disk-queue-size", 1<<30, "max size of the disk queue in bytes")
+	shutdownFlag      = flag.Duration("shutdown-timeout", 30*time.Second,
+		"timeout to forward the buffered requests on shutdown")
+)
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: uptrace-agent [flags]\n")
+	flag.PrintDefaults()
+}
+
+func run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := []uptrace.Option{
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+		uptrace.WithResourceDetectors(hostDetector{}),
+	}
+	if *dsnFlag != "" {
+		opts = append(opts, uptrace.WithDSN(*dsnFlag))
+	}
+	if *diskQueueFlag != "" {
+		opts = append(opts, uptrace.WithDiskQueue(*diskQueueFlag, *diskQueueSizeFlag))
+	}
+
+	client, err := uptrace.New(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Shutdown(context.Background())
+	}()
+
+	agent := newAgent(client, hostAttributes(client.Resource()), *queueSizeFlag, log.Default())
+	agent.start(*workersFlag)
+
+	errCh := make(chan error, 2)
+
+	httpLn, err := net.Listen("tcp", *httpFlag)
+	if err != nil {
+		return err
+	}
+	httpSrv := &http.Server{
+		Handler:           agent,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := httpSrv.Serve(httpLn); !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+	}()
+	log.Printf("receiving OTLP/HTTP on %s", httpLn.Addr())
+
+	var grpcSrv *grpc.Server
+	if *grpcFlag != "" {
+		grpcLn, err := net.Listen("tcp", *grpcFlag)
+		if err != nil {
+			return err
+		}
+		grpcSrv = grpc.NewServer()
+		agent.registerGRPC(grpcSrv)
+		go func() {
+			if err := grpcSrv.Serve(grpcLn); err != nil {
+				errCh <- err
+			}
+		}()
+		log.Printf("receiving OTLP/gRPC on %s", grpcLn.Addr())
+	}
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+	case serveErr = <-errCh:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownFlag)
+	defer cancel()
+
+	if err := httpSrv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP receiver was not stopped gracefully: %s", err)
+	}
+	if grpcSrv != nil {
+		stopGRPC(shutdownCtx, grpcSrv)
+	}
+	if err := agent.close(shutdownCtx); err != nil {
+		log.Printf("buffered requests were not forwarded: %s", err)
+	}
+	return serveErr
+}
+
+// stopGRPC stops the gRPC server gracefully and closes the remaining
+// connections when ctx is done.
+func stopGRPC(ctx context.Context, srv *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("gRPC receiver was not stopped gracefully: %s", ctx.Err())
+		srv.Stop()
+		<-done
+	}
+}
+
+// hostDetector detects the host ID and the OS in addition to the host name
+// detected by the client.
+type hostDetector struct{}
+
+func (hostDetector) Detect(ctx context.Context) (*resource.Resource, error) {
+	return resource.New(ctx, resource.WithHostID(), resource.WithOS())
+}
+
+// hostAttributes returns the resource attributes added to the forwarded data.
+// The telemetry SDK attributes describe the agent rather than the application.
+func hostAttributes(res *resource.Resource) []*commonpb.KeyValue {
+	var attrs []attribute.KeyValue
+	for _, kv := range res.Attributes() {
+		if !strings.HasPrefix(string(kv.Key), "telemetry.sdk.") {
+			attrs = append(attrs, kv)
+		}
+	}
+	return otlpAttributes(attrs)
+}
@@ -0,0 +1,610 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/uptrace/uptrace-go/internal/otlpjson"
+	"github.com/uptrace/uptrace-go/internal/otlpproto"
+	"github.com/uptrace/uptrace-go/uptrace"
+)
+
+const (
+	maxRecordSize = 64 << 20
+	replayRetries = 3
+)
+
+func replayUsage(flags *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "usage: uptrace-run replay [flags] file_or_dir...\n\n"+
+			"Uploads OTLP/JSON lines files or length-prefixed OTLP protobuf files to Uptrace.\n"+
+			"Files compressed with gzip are supported. The DSN is read from UPTRACE_DSN.\n\n")
+		flags.PrintDefaults()
+	}
+}
+
+// replayMain runs the replay subcommand and returns the exit code.
+func replayMain(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.Usage = replayUsage(flags)
+
+	dsn := flags.String("dsn", "", "Uptrace DSN (default is UPTRACE_DSN env var)")
+	signal := flags.String("signal", "",
+		"signal of the files: traces, metrics, or logs (default is to detect the signal)")
+	batchSize := flags.Int("batch-size", 1000, "max number of items in an upload request")
+	checkpoint := flags.String("checkpoint", "",
+		"file to save the progress to and resume from")
+	dryRun := flags.Bool("dry-run", false, "validate the files without uploading")
+	progress := flags.Duration("progress", 10*time.Second, "progress reporting interval")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	conf := &replayConfig{
+		batchSize:        *batchSize,
+		dryRun:           *dryRun,
+		progressInterval: *progress,
+		logger:           log.Default(),
+	}
+	if *signal != "" {
+		switch s := uptrace.Signal(*signal); s {
+		case uptrace.SignalTraces, uptrace.SignalMetrics, uptrace.SignalLogs:
+			conf.signal = s
+		default:
+			log.Printf("unsupported signal: %q", *signal)
+			return 2
+		}
+	}
+
+	paths, err := replayFiles(flags.Args())
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	ctx := context.Background()
+
+	if *checkpoint != "" {
+		cp, err := loadCheckpoint(*checkpoint)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		conf.checkpoint = cp
+	}
+
+	if !conf.dryRun {
+		opts := []uptrace.Option{
+			uptrace.WithMetricsDisabled(),
+			uptrace.WithLoggingDisabled(),
+			uptrace.WithoutGlobals(),
+		}
+		if *dsn != "" {
+			opts = append(opts, uptrace.WithDSN(*dsn))
+		}
+
+		client, err := uptrace.New(ctx, opts...)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		defer func() {
+			_ = client.Shutdown(ctx)
+		}()
+		conf.exporter = client
+	}
+
+	r := newReplayer(conf)
+	err = r.replay(ctx, paths)
+	r.report("done")
+	if err != nil {
+		log.Print(err)
+		if conf.checkpoint != nil && !conf.dryRun {
+			log.Printf("run the same command to resume from the checkpoint %s", *checkpoint)
+		}
+		return 1
+	}
+	return 0
+}
+
+// replayFiles expands directories into the files they contain.
+func replayFiles(args []string) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+
+		var files []string
+		if err := filepath.WalkDir(arg, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				files = append(files, path)
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		// Rotated files, for example, `traces-<time>.jsonl.gz`,
+		// sort before the active file `traces.jsonl`.
+		slices.Sort(files)
+		paths = append(paths, files...)
+	}
+	return paths, nil
+}
+
+//------------------------------------------------------------------------------
+
+type otlpExporter interface {
+	ExportOTLP(ctx context.Context, signal uptrace.Signal, body []byte) error
+}
+
+type replayConfig struct {
+	exporter         otlpExporter
+	signal           uptrace.Signal
+	batchSize        int
+	dryRun           bool
+	checkpoint       *checkpoint
+	progressInterval time.Duration
+	logger           *log.Logger
+}
+
+type replayer struct {
+	conf *replayConfig
+
+	batches map[uptrace.Signal]*replayBatch
+
+	files      int
+	records    int
+	items      map[uptrace.Signal]int
+	requests   int
+	errors     int
+	lastReport time.Time
+}
+
+func newReplayer(conf *replayConfig) *replayer {
+	return &replayer{
+		conf:       conf,
+		batches:    make(map[uptrace.Signal]*replayBatch),
+		items:      make(map[uptrace.Signal]int),
+		lastReport: time.Now(),
+	}
+}
+
+// replay uploads the files. In the dry-run mode, it validates all files
+// and returns an error if any record is invalid.
+func (r *replayer) replay(ctx context.Context, paths []string) error {
+	for _, path := range paths {
+		if err := r.replayFile(ctx, path); err != nil {
+			if r.conf.dryRun {
+				r.errors++
+				r.conf.logger.Print(err)
+				continue
+			}
+			return err
+		}
+	}
+	if r.errors > 0 {
+		return fmt.Errorf("found %d invalid files", r.errors)
+	}
+	return nil
+}
+
+func (r *replayer) replayFile(ctx context.Context, path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	var state checkpointFile
+	if r.conf.checkpoint != nil {
+		state = r.conf.checkpoint.Files[absPath]
+		if state.Done && state.Size == fi.Size() && state.ModTime.Equal(fi.ModTime()) {
+			return nil
+		}
+		// The file is appended to or rewritten.
+		state.Done = false
+		if state.Size > fi.Size() {
+			state = checkpointFile{}
+		}
+		state.Size = fi.Size()
+		state.ModTime = fi.ModTime()
+	}
+
+	reader, err := openRecordReader(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	r.files++
+	var record int
+	for {
+		b, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: record %d: %w", path, record+1, err)
+		}
+		record++
+		if record == 1 {
+			// The file exporter reuses the active file names after rotation
+			// so the first record identifies the file.
+			if hash := recordHash(b); hash != state.FirstRecord {
+				state = checkpointFile{Size: state.Size, ModTime: state.ModTime, FirstRecord: hash}
+			}
+		}
+		if record <= state.Records {
+			continue
+		}
+
+		signal, msg, err := r.decode(reader, path, b)
+		if err != nil {
+			return fmt.Errorf("%s: record %d: %w", path, record, err)
+		}
+		r.records++
+
+		if r.conf.dryRun {
+			r.items[signal] += otlpproto.CountItems(msg)
+		} else if r.add(signal, msg) >= r.conf.batchSize {
+			state.Records = record
+			if err := r.flush(ctx, absPath, state); err != nil {
+				return err
+			}
+		}
+
+		if r.conf.progressInterval > 0 && time.Since(r.lastReport) >= r.conf.progressInterval {
+			r.report(path)
+		}
+	}
+
+	if r.conf.dryRun {
+		return nil
+	}
+	state.Records = record
+	state.Done = true
+	return r.flush(ctx, absPath, state)
+}
+
+func (r *replayer) decode(reader recordReader, path string, b []byte) (uptrace.Signal, proto.Message, error) {
+	signal := r.conf.signal
+	if signal == "" && reader.isJSON() {
+		signal = jsonSignal(b)
+	}
+	if signal == "" {
+		signal = fileSignal(path)
+	}
+	if signal == "" {
+		return "", nil, errors.New("can't detect the signal (use -signal flag)")
+	}
+
+	msg := otlpproto.NewExportRequest(string(signal))
+	if reader.isJSON() {
+		if err := otlpjson.Unmarshal(b, msg); err != nil {
+			return "", nil, err
+		}
+	} else {
+		if err := proto.Unmarshal(b, msg); err != nil {
+			return "", nil, err
+		}
+	}
+	return signal, msg, nil
+}
+
+// add adds the message to the batch and returns the number of items in the batch.
+func (r *replayer) add(signal uptrace.Signal, msg proto.Message) int {
+	batch, ok := r.batches[signal]
+	if !ok {
+		batch = &replayBatch{signal: signal, msg: otlpproto.NewExportRequest(string(signal))}
+		r.batches[signal] = batch
+	}
+	batch.add(msg)
+	return batch.items
+}
+
+// flush uploads the batches and saves the checkpoint.
+func (r *replayer) flush(ctx context.Context, path string, state checkpointFile) error {
+	for _, signal := range []uptrace.Signal{
+		uptrace.SignalTraces, uptrace.SignalMetrics, uptrace.SignalLogs,
+	} {
+		batch, ok := r.batches[signal]
+		if !ok {
+			continue
+		}
+		if err := r.upload(ctx, batch); err != nil {
+			return fmt.Errorf("%s: upload failed: %w", path, err)
+		}
+		r.items[signal] += batch.items
+		delete(r.batches, signal)
+	}
+
+	if r.conf.checkpoint == nil {
+		return nil
+	}
+	r.conf.checkpoint.Files[path] = state
+	return r.conf.checkpoint.save()
+}
+
+func (r *replayer) upload(ctx context.Context, batch *replayBatch) error {
+	body, err := proto.Marshal(batch.msg)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		r.requests++
+		err = r.conf.exporter.ExportOTLP(ctx, batch.signal, body)
+		if err == nil || errors.Is(err, uptrace.ErrDSNRejected) || attempt >= replayRetries {
+			return err
+		}
+		r.conf.logger.Printf("upload failed (retrying): %s", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+}
+
+func (r *replayer) report(status string) {
+	r.lastReport = time.Now()
+	r.conf.logger.Printf("replay %s: %d files, %d records, %d spans, %d data points, %d logs, %d requests",
+		status, r.files, r.records,
+		r.items[uptrace.SignalTraces],
+		r.items[uptrace.SignalMetrics],
+		r.items[uptrace.SignalLogs],
+		r.requests)
+}
+
+//------------------------------------------------------------------------------
+
+// replayBatch merges small export requests into a single request.
+type replayBatch struct {
+	signal uptrace.Signal
+	msg    proto.Message
+	items  int
+}
+
+func (b *replayBatch) add(msg proto.Message) {
+	switch dst := b.msg.(type) {
+	case *collectortrace.ExportTraceServiceRequest:
+		dst.ResourceSpans = append(dst.ResourceSpans,
+			msg.(*collectortrace.ExportTraceServiceRequest).ResourceSpans...)
+	case *collectormetrics.ExportMetricsServiceRequest:
+		dst.ResourceMetrics = append(dst.ResourceMetrics,
+			msg.(*collectormetrics.ExportMetricsServiceRequest).ResourceMetrics...)
+	case *collectorlogs.ExportLogsServiceRequest:
+		dst.ResourceLogs = append(dst.ResourceLogs,
+			msg.(*collectorlogs.ExportLogsServiceRequest).ResourceLogs...)
+	}
+	b.items += otlpproto.CountItems(msg)
+}
+
+// jsonSignal detects the signal using the top-level field of the OTLP/JSON request.
+func jsonSignal(b []byte) uptrace.Signal {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return ""
+	}
+	for key := range fields {
+		switch key {
+		case "resourceSpans", "resource_spans":
+			return uptrace.SignalTraces
+		case "resourceMetrics", "resource_metrics":
+			return uptrace.SignalMetrics
+		case "resourceLogs", "resource_logs":
+			return uptrace.SignalLogs
+		}
+	}
+	return ""
+}
+
+// fileSignal detects the signal using the file name, for example, `traces.pb`.
+func fileSignal(path string) uptrace.Signal {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.Contains(name, "trace"), strings.Contains(name, "span"):
+		return uptrace.SignalTraces
+	case strings.Contains(name, "metric"):
+		return uptrace.SignalMetrics
+	case strings.Contains(name, "log"):
+		return uptrace.SignalLogs
+	default:
+		return ""
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// recordReader reads OTLP export requests from a file.
+type recordReader interface {
+	Next() ([]byte, error)
+	isJSON() bool
+	Close() error
+}
+
+// openRecordReader opens the file detecting the format using the file extension:
+// `.pb`, `.binpb`, and `.proto` files contain protobuf messages prefixed with
+// the 4-byte big-endian size, and other files contain OTLP/JSON lines.
+func openRecordReader(path string) (recordReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rd io.Reader = f
+	ext := filepath.Ext(path)
+	if ext == ".gz" {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		rd = zr
+		ext = filepath.Ext(strings.TrimSuffix(path, ext))
+	}
+
+	switch ext {
+	case ".pb", ".binpb", ".proto":
+		return &protoRecordReader{f: f, r: bufio.NewReader(rd)}, nil
+	default:
+		scanner := bufio.NewScanner(rd)
+		scanner.Buffer(nil, maxRecordSize)
+		return &jsonRecordReader{f: f, scanner: scanner}, nil
+	}
+}
+
+type jsonRecordReader struct {
+	f       *os.File
+	scanner *bufio.Scanner
+}
+
+func (r *jsonRecordReader) Next() ([]byte, error) {
+	for r.scanner.Scan() {
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) > 0 {
+			return line, nil
+		}
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (r *jsonRecordReader) isJSON() bool { return true }
+
+func (r *jsonRecordReader) Close() error { return r.f.Close() }
+
+type protoRecordReader struct {
+	f *os.File
+	r *bufio.Reader
+}
+
+func (r *protoRecordReader) Next() ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r.r, size[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("truncated record size")
+		}
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxRecordSize {
+		return nil, fmt.Errorf("record size %d exceeds %d bytes", n, maxRecordSize)
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, errors.New("truncated record")
+	}
+	return b, nil
+}
+
+func (r *protoRecordReader) isJSON() bool { return false }
+
+func (r *protoRecordReader) Close() error { return r.f.Close() }
+
+//------------------------------------------------------------------------------
+
+// checkpoint stores the number of uploaded records for each file.
+type checkpoint struct {
+	path  string
+	Files map[string]checkpointFile `json:"files"`
+}
+
+// checkpointFile stores the progress and the identity of the file. The progress
+// is reset when the file shrinks or its first record changes, and the new records
+// are uploaded when the file is modified after it was done.
+type checkpointFile struct {
+	Records int  `json:"records"`
+	Done    bool `json:"done,omitempty"`
+
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	FirstRecord string    `json:"first_record,omitempty"`
+}
+
+// recordHash returns the hash used to identify the file by its first record.
+func recordHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:16])
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{
+		path:  path,
+		Files: make(map[string]checkpointFile),
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %w", path, err)
+	}
+	if cp.Files == nil {
+		cp.Files = make(map[string]checkpointFile)
+	}
+	return cp, nil
+}
+
+// save atomically replaces the checkpoint file.
+func (cp *checkpoint) save() error {
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := cp.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cp.path)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/uptrace/uptrace-go/internal/otlpjson"
+	"github.com/uptrace/uptrace-go/internal/otlpproto"
+	"github.com/uptrace/uptrace-go/uptrace"
+)
+
+type upload struct {
+	signal uptrace.Signal
+	items  int
+}
+
+type fakeExporter struct {
+	uploads []upload
+	fail    int
+}
+
+func (e *fakeExporter) ExportOTLP(ctx context.Context, signal uptrace.Signal, body []byte) error {
+	if e.fail > 0 && len(e.uploads)+1 == e.fail {
+		e.fail = 0
+		return uptrace.ErrDSNRejected
+	}
+
+	msg := otlpproto.NewExportRequest(string(signal))
+	if err := proto.Unmarshal(body, msg); err != nil {
+		return err
+	}
+	e.uploads = append(e.uploads, upload{signal: signal, items: otlpproto.CountItems(msg)})
+	return nil
+}
+
+func newTraceRequest(numSpan int) *collectortrace.ExportTraceServiceRequest {
+	spans := make([]*tracepb.Span, numSpan)
+	for i := range spans {
+		spans[i] = &tracepb.Span{
+			TraceId: []byte("0123456789abcdef"),
+			SpanId:  []byte("01234567"),
+			Name:    "span",
+		}
+	}
+	return &collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: spans}},
+		}},
+	}
+}
+
+func newLogRequest(numRecord int) *collectorlogs.ExportLogsServiceRequest {
+	return &collectorlogs.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			ScopeLogs: []*logspb.ScopeLogs{{
+				LogRecords: make([]*logspb.LogRecord, numRecord),
+			}},
+		}},
+	}
+}
+
+func writeJSONLines(t *testing.T, path string, msgs ...proto.Message) {
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var w io.Writer = f
+	if filepath.Ext(path) == ".gz" {
+		zw := gzip.NewWriter(f)
+		defer zw.Close()
+		w = zw
+	}
+
+	for _, msg := range msgs {
+		b, err := otlpjson.Marshal(msg)
+		require.NoError(t, err)
+		_, err = w.Write(append(b, '\n'))
+		require.NoError(t, err)
+	}
+}
+
+func newTestReplayConfig(exporter otlpExporter) *replayConfig {
+	return &replayConfig{
+		exporter:  exporter,
+		batchSize: 2,
+		logger:    log.New(io.Discard, "", 0),
+	}
+}
+
+func TestReplayJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeJSONLines(t, filepath.Join(dir, "traces-20261018T000000.000Z.jsonl.gz"),
+		newTraceRequest(1), newTraceRequest(1))
+	writeJSONLines(t, filepath.Join(dir, "traces.jsonl"), newTraceRequest(3))
+	writeJSONLines(t, filepath.Join(dir, "logs.jsonl"), newLogRequest(1))
+
+	paths, err := replayFiles([]string{dir})
+	require.NoError(t, err)
+
+	exporter := new(fakeExporter)
+	r := newReplayer(newTestReplayConfig(exporter))
+	require.NoError(t, r.replay(context.Background(), paths))
+
+	require.Equal(t, []upload{
+		{signal: uptrace.SignalLogs, items: 1},
+		{signal: uptrace.SignalTraces, items: 2},
+		{signal: uptrace.SignalTraces, items: 3},
+	}, exporter.uploads)
+	require.Equal(t, 5, r.items[uptrace.SignalTraces])
+	require.Equal(t, 1, r.items[uptrace.SignalLogs])
+}
+
+func TestReplayProtobuf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.pb")
+
+	var data []byte
+	for _, n := range []int{1, 2} {
+		b, err := proto.Marshal(newTraceRequest(n))
+		require.NoError(t, err)
+		data = binary.BigEndian.AppendUint32(data, uint32(len(b)))
+		data = append(data, b...)
+	}
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	exporter := new(fakeExporter)
+	conf := newTestReplayConfig(exporter)
+	conf.batchSize = 100
+	r := newReplayer(conf)
+	require.NoError(t, r.replay(context.Background(), []string{path}))
+
+	require.Equal(t, []upload{{signal: uptrace.SignalTraces, items: 3}}, exporter.uploads)
+}
+
+func TestReplayCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "traces.jsonl")
+	writeJSONLines(t, path,
+		newTraceRequest(2), newTraceRequest(2), newTraceRequest(2))
+	checkpointPath := filepath.Join(dir, "checkpoint.json")
+
+	cp, err := loadCheckpoint(checkpointPath)
+	require.NoError(t, err)
+
+	exporter := &fakeExporter{fail: 2}
+	conf := newTestReplayConfig(exporter)
+	conf.checkpoint = cp
+	err = newReplayer(conf).replay(ctx, []string{path})
+	require.True(t, errors.Is(err, uptrace.ErrDSNRejected))
+	require.Len(t, exporter.uploads, 1)
+
+	cp, err = loadCheckpoint(checkpointPath)
+	require.NoError(t, err)
+	absPath, err := filepath.Abs(path)
+	require.NoError(t, err)
+	require.Equal(t, 1, cp.Files[absPath].Records)
+	require.False(t, cp.Files[absPath].Done)
+
+	conf.checkpoint = cp
+	require.NoError(t, newReplayer(conf).replay(ctx, []string{path}))
+	require.Len(t, exporter.uploads, 3)
+
+	// The file is skipped once it is uploaded.
+	cp, err = loadCheckpoint(checkpointPath)
+	require.NoError(t, err)
+	require.Equal(t, 3, cp.Files[absPath].Records)
+	require.True(t, cp.Files[absPath].Done)
+
+	conf.checkpoint = cp
+	require.NoError(t, newReplayer(conf).replay(ctx, []string{path}))
+	require.Len(t, exporter.uploads, 3)
+}
+
+func TestReplayCheckpointFileChanged(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "traces.jsonl")
+	checkpointPath := filepath.Join(dir, "checkpoint.json")
+
+	replay := func(exporter *fakeExporter) {
+		cp, err := loadCheckpoint(checkpointPath)
+		require.NoError(t, err)
+		conf := newTestReplayConfig(exporter)
+		conf.batchSize = 1
+		conf.checkpoint = cp
+		require.NoError(t, newReplayer(conf).replay(ctx, []string{path}))
+	}
+
+	writeJSONLines(t, path, newTraceRequest(1), newTraceRequest(2))
+	exporter := new(fakeExporter)
+	replay(exporter)
+	require.Len(t, exporter.uploads, 2)
+
+	// The records appended to the active file are uploaded.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	b, err := otlpjson.Marshal(newTraceRequest(3))
+	require.NoError(t, err)
+	_, err = f.Write(append(b, '\n'))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	exporter = new(fakeExporter)
+	replay(exporter)
+	require.Equal(t, []upload{{signal: uptrace.SignalTraces, items: 3}}, exporter.uploads)
+
+	// The rotated and recreated file is uploaded from the start.
+	writeJSONLines(t, path, newTraceRequest(4), newTraceRequest(5), newTraceRequest(6))
+	exporter = new(fakeExporter)
+	replay(exporter)
+	require.Equal(t, []upload{
+		{signal: uptrace.SignalTraces, items: 4},
+		{signal: uptrace.SignalTraces, items: 5},
+		{signal: uptrace.SignalTraces, items: 6},
+	}, exporter.uploads)
+}
+
+func TestReplayDryRun(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "traces.jsonl")
+	writeJSONLines(t, valid, newTraceRequest(2))
+
+	invalid := filepath.Join(dir, "invalid.jsonl")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"resourceSpans": 1}`+"\n"), 0o644))
+
+	conf := newTestReplayConfig(nil)
+	conf.dryRun = true
+	r := newReplayer(conf)
+
+	err := r.replay(context.Background(), []string{valid, invalid})
+	require.Error(t, err)
+	require.Equal(t, 2, r.items[uptrace.SignalTraces])
+}
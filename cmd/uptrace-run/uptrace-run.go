@@ -27,6 +27,10 @@ var (
 var tracer = otel.Tracer("github.com/uptrace/uptrace-go")
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(replayMain(os.Args[2:]))
+	}
+
 	flag.Usage = usage
 	flag.Parse()
 
@@ -111,6 +115,7 @@ func main() {
 
 func usage() {
 	fmt.Fprintf(os.Stderr, `usage: uptrace-run [flags] -cmd="/path/to/executable"`+"\n")
+	fmt.Fprintf(os.Stderr, `       uptrace-run replay [flags] file_or_dir...`+"\n")
 	flag.PrintDefaults()
 }
 
@@ -0,0 +1,110 @@
+// Package otlpjson encodes and decodes OTLP messages using the OTLP/JSON encoding.
+//
+// OTLP/JSON is the protobuf JSON mapping with two exceptions: trace and span IDs
+// are hex-encoded instead of base64-encoded and enums are encoded as integers.
+package otlpjson
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Marshal encodes the OTLP message as a single line of OTLP/JSON.
+func Marshal(m proto.Message) ([]byte, error) {
+	b, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := decode(b)
+	if err != nil {
+		return nil, err
+	}
+	convertIDs(v, base64ToHex)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Unmarshal decodes OTLP/JSON into the OTLP message. Base64-encoded IDs
+// produced by the standard protobuf JSON mapping are accepted too.
+func Unmarshal(b []byte, m proto.Message) error {
+	v, err := decode(b)
+	if err != nil {
+		return err
+	}
+	convertIDs(v, hexToBase64)
+
+	b, err = json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(b, m)
+}
+
+func decode(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// convertIDs converts trace and span IDs in the decoded JSON in place.
+func convertIDs(v any, fn func(string) string) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			if s, ok := val.(string); ok && isIDField(k) {
+				v[k] = fn(s)
+				continue
+			}
+			convertIDs(val, fn)
+		}
+	case []any:
+		for _, val := range v {
+			convertIDs(val, fn)
+		}
+	}
+}
+
+func isIDField(key string) bool {
+	switch key {
+	case "traceId", "spanId", "parentSpanId",
+		"trace_id", "span_id", "parent_span_id":
+		return true
+	default:
+		return false
+	}
+}
+
+func base64ToHex(s string) string {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return s
+	}
+	return hex.EncodeToString(b)
+}
+
+// hexToBase64 converts hex-encoded IDs. Base64-encoded IDs are left as is:
+// 8- and 16-byte IDs are padded with "=" so they are never valid hex.
+func hexToBase64(s string) string {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return s
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,71 @@
+// Package otlpproto contains helpers for OTLP export requests shared by
+// the exporters and the commands.
+package otlpproto
+
+import (
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// NewExportRequest returns an empty OTLP export request for the signal:
+// `traces`, `metrics`, or `logs`.
+func NewExportRequest(signal string) proto.Message {
+	switch signal {
+	case "traces":
+		return new(collectortrace.ExportTraceServiceRequest)
+	case "metrics":
+		return new(collectormetrics.ExportMetricsServiceRequest)
+	default:
+		return new(collectorlogs.ExportLogsServiceRequest)
+	}
+}
+
+// CountItems returns the number of spans, metric data points, or log records
+// in the export request.
+func CountItems(msg proto.Message) int {
+	var n int
+	switch msg := msg.(type) {
+	case *collectortrace.ExportTraceServiceRequest:
+		for _, rs := range msg.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				n += len(ss.Spans)
+			}
+		}
+	case *collectormetrics.ExportMetricsServiceRequest:
+		for _, rm := range msg.ResourceMetrics {
+			for _, sm := range rm.ScopeMetrics {
+				for _, m := range sm.Metrics {
+					n += MetricDataPoints(m)
+				}
+			}
+		}
+	case *collectorlogs.ExportLogsServiceRequest:
+		for _, rl := range msg.ResourceLogs {
+			for _, sl := range rl.ScopeLogs {
+				n += len(sl.LogRecords)
+			}
+		}
+	}
+	return n
+}
+
+// MetricDataPoints returns the number of data points in the metric.
+func MetricDataPoints(metric *metricspb.Metric) int {
+	switch data := metric.Data.(type) {
+	case *metricspb.Metric_Gauge:
+		return len(data.Gauge.GetDataPoints())
+	case *metricspb.Metric_Sum:
+		return len(data.Sum.GetDataPoints())
+	case *metricspb.Metric_Histogram:
+		return len(data.Histogram.GetDataPoints())
+	case *metricspb.Metric_ExponentialHistogram:
+		return len(data.ExponentialHistogram.GetDataPoints())
+	case *metricspb.Metric_Summary:
+		return len(data.Summary.GetDataPoints())
+	default:
+		return 0
+	}
+}
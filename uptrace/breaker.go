@@ -0,0 +1,186 @@
+package uptrace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptrace/uptrace-go/internal"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// breakerRetryInterval is how often a request is let through to check whether
+// Uptrace accepts the DSN again.
+const breakerRetryInterval = 5 * time.Minute
+
+// breaker stops exporting data to a DSN that Uptrace rejects.
+type breaker struct {
+	dsn     *DSN
+	onError func(err error)
+	// reload is called while the breaker is open to check whether the DSN was rotated.
+	reload func()
+
+	mu          sync.Mutex
+	err         error
+	lastAttempt time.Time
+}
+
+func newBreaker(dsn *DSN, onError func(err error)) *breaker {
+	return &breaker{
+		dsn:     dsn,
+		onError: onError,
+	}
+}
+
+// Err returns the error that opened the breaker or nil.
+func (b *breaker) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.err
+}
+
+// allow returns an error if the breaker is open. Once per retry interval,
+// a request is allowed to check whether the DSN is accepted again.
+func (b *breaker) allow() error {
+	if b.reload != nil && b.Err() != nil {
+		b.reload()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.err == nil {
+		return nil
+	}
+	if time.Since(b.lastAttempt) >= breakerRetryInterval {
+		b.lastAttempt = time.Now()
+		return nil
+	}
+	return b.err
+}
+
+// trip opens the breaker. The error is reported once when the breaker is opened.
+func (b *breaker) trip(err error) {
+	b.mu.Lock()
+	wasOpen := b.err != nil
+	b.err = err
+	b.lastAttempt = time.Now()
+	b.mu.Unlock()
+
+	if !wasOpen && b.onError != nil {
+		b.onError(err)
+	}
+}
+
+func (b *breaker) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.err = nil
+}
+
+func logError(err error) {
+	internal.Logger.Printf("%s (exporting is stopped)", err)
+}
+
+func (b *breaker) rejected(reason string) error {
+	return fmt.Errorf("%w: %s: %s", ErrDSNRejected, b.dsn.SiteURL(), reason)
+}
+
+// unaryClientInterceptor opens the breaker when Uptrace rejects the DSN.
+func (b *breaker) unaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply any,
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	switch status.Code(err) {
+	case codes.OK:
+		b.reset()
+	case codes.Unauthenticated, codes.PermissionDenied, codes.NotFound:
+		b.trip(b.rejected(status.Convert(err).Message()))
+	}
+	return err
+}
+
+//------------------------------------------------------------------------------
+
+// breakerTransport opens the breaker when Uptrace rejects the DSN.
+type breakerTransport struct {
+	breaker *breaker
+	next    http.RoundTripper
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.breaker.allow(); err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		t.breaker.reset()
+	case isRejectedHTTPStatus(resp.StatusCode):
+		const maxMessageSize = 1 << 10
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+		_ = resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(msg))
+
+		reason := resp.Status
+		if s := strings.TrimSpace(string(msg)); s != "" {
+			reason += ": " + s
+		}
+		t.breaker.trip(t.breaker.rejected(reason))
+	}
+	return resp, nil
+}
+
+func isRejectedHTTPStatus(code int) bool {
+	switch code {
+	case http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusNotFound:
+		return true
+	default:
+		return false
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// Status returns nil when data is being exported or the errors that stopped exporting,
+// for example, when Uptrace rejects the DSN token. It can be used in health checks.
+// The returned error matches ErrDSNRejected with errors.Is.
+func (c *Client) Status() error {
+	var errs []error
+	for _, t := range c.transports {
+		if err := t.breaker.Err(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
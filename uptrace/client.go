@@ -10,30 +10,40 @@ import (
 	"go.opentelemetry.io/otel/codes"
 	sdklog "go.opentelemetry.io/otel/sdk/log"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
 )
 
 const dummySpanName = "__dummy__"
 
-// client represents Uptrace client.
-type client struct {
+// Client represents Uptrace client. Use New to create a client or
+// ConfigureOpentelemetry to configure the client used by the package-level functions.
+type Client struct {
 	dsn    *DSN
 	tracer trace.Tracer
 
 	tp *sdktrace.TracerProvider
 	mp *sdkmetric.MeterProvider
 	lp *sdklog.LoggerProvider
+
+	transports    []*transport
+	failover      *failover
+	fileExporter  *fileExporter
+	remoteSampler *RemoteSampler
+	stats         []*exportStats
+	resource      *resource.Resource
 }
 
-func newClient(dsn *DSN) *client {
-	return &client{
+func newClient(dsn *DSN) *Client {
+	return &Client{
 		dsn:    dsn,
 		tracer: otel.Tracer("uptrace-go"),
 	}
 }
 
-func (c *client) Shutdown(ctx context.Context) (lastErr error) {
+// Shutdown flushes buffered data and shuts down the tracer, meter, and logger providers.
+func (c *Client) Shutdown(ctx context.Context) (lastErr error) {
 	if c.tp != nil {
 		if err := c.tp.Shutdown(ctx); err != nil {
 			lastErr = err
@@ -52,10 +62,29 @@ func (c *client) Shutdown(ctx context.Context) (lastErr error) {
 		}
 		c.lp = nil
 	}
+	for _, t := range c.transports {
+		if err := t.Close(); err != nil {
+			lastErr = err
+		}
+	}
+	c.transports = nil
+	if c.fileExporter != nil {
+		if err := c.fileExporter.Close(); err != nil {
+			lastErr = err
+		}
+		c.fileExporter = nil
+	}
+	if c.remoteSampler != nil {
+		if err := c.remoteSampler.Close(); err != nil {
+			lastErr = err
+		}
+		c.remoteSampler = nil
+	}
 	return lastErr
 }
 
-func (c *client) ForceFlush(ctx context.Context) (lastErr error) {
+// ForceFlush immediately exports all buffered data.
+func (c *Client) ForceFlush(ctx context.Context) (lastErr error) {
 	if c.tp != nil {
 		if err := c.tp.ForceFlush(ctx); err != nil {
 			lastErr = err
@@ -74,15 +103,37 @@ func (c *client) ForceFlush(ctx context.Context) (lastErr error) {
 	return lastErr
 }
 
+// TracerProvider returns the tracer provider or nil if tracing is disabled.
+func (c *Client) TracerProvider() *sdktrace.TracerProvider {
+	return c.tp
+}
+
+// MeterProvider returns the meter provider or nil if metrics are disabled.
+func (c *Client) MeterProvider() *sdkmetric.MeterProvider {
+	return c.mp
+}
+
+// LoggerProvider returns the logger provider or nil if logging is disabled.
+func (c *Client) LoggerProvider() *sdklog.LoggerProvider {
+	return c.lp
+}
+
+// Resource returns the resource used by the tracer, meter, and logger providers.
+// It includes the attributes configured with options, resource detectors,
+// the config file, and OTEL_RESOURCE_ATTRIBUTES env var.
+func (c *Client) Resource() *resource.Resource {
+	return c.resource
+}
+
 // TraceURL returns the trace URL for the span.
-func (c *client) TraceURL(span trace.Span) string {
+func (c *Client) TraceURL(span trace.Span) string {
 	sctx := span.SpanContext()
 	return fmt.Sprintf("%s/traces/%s?span_id=%s",
 		c.dsn.SiteURL(), sctx.TraceID(), sctx.SpanID().String())
 }
 
 // ReportError reports an error as a span event creating a dummy span if necessary.
-func (c *client) ReportError(ctx context.Context, err error, opts ...trace.EventOption) {
+func (c *Client) ReportError(ctx context.Context, err error, opts ...trace.EventOption) {
 	span := trace.SpanFromContext(ctx)
 	if !span.IsRecording() {
 		_, span = c.tracer.Start(ctx, dummySpanName)
@@ -93,7 +144,7 @@ func (c *client) ReportError(ctx context.Context, err error, opts ...trace.Event
 }
 
 // ReportPanic is used with defer to report panics.
-func (c *client) ReportPanic(ctx context.Context, val any) {
+func (c *Client) ReportPanic(ctx context.Context, val any) {
 	c.reportPanic(ctx, val)
 	// Force flush since we are about to exit on panic.
 	if c.tp != nil {
@@ -101,14 +152,14 @@ func (c *client) ReportPanic(ctx context.Context, val any) {
 	}
 }
 
-func (c *client) reportPanic(ctx context.Context, val interface{}) {
+func (c *Client) reportPanic(ctx context.Context, val interface{}) {
 	span := trace.SpanFromContext(ctx)
 	if !span.IsRecording() {
 		_, span = c.tracer.Start(ctx, dummySpanName)
 		defer span.End()
 	}
 
-	stackTrace := make([]byte, 10 << 10)
+	stackTrace := make([]byte, 10<<10)
 	n := runtime.Stack(stackTrace, false)
 
 	span.SetStatus(codes.Error, fmt.Sprint(val))
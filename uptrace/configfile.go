@@ -0,0 +1,397 @@
+package uptrace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is a subset of the OpenTelemetry file configuration schema
+// extended with the Uptrace-specific `uptrace` section. Durations are in milliseconds.
+type fileConfig struct {
+	FileFormat string `yaml:"file_format"`
+	Disabled   *bool  `yaml:"disabled"`
+
+	Resource struct {
+		Attributes     []fileAttribute `yaml:"attributes"`
+		AttributesList string          `yaml:"attributes_list"`
+	} `yaml:"resource"`
+
+	Propagator struct {
+		Composite     []string `yaml:"composite"`
+		CompositeList string   `yaml:"composite_list"`
+	} `yaml:"propagator"`
+
+	TracerProvider struct {
+		Processors []fileProcessor `yaml:"processors"`
+		Sampler    fileSampler     `yaml:"sampler"`
+	} `yaml:"tracer_provider"`
+
+	MeterProvider struct {
+		Readers []struct {
+			Periodic *struct {
+				Interval *int `yaml:"interval"`
+			} `yaml:"periodic"`
+		} `yaml:"readers"`
+	} `yaml:"meter_provider"`
+
+	LoggerProvider struct {
+		Processors []fileProcessor `yaml:"processors"`
+	} `yaml:"logger_provider"`
+
+	Uptrace struct {
+		DSN            stringList `yaml:"dsn"`
+		DSNFile        string     `yaml:"dsn_file"`
+		Protocol       string     `yaml:"protocol"`
+		DSNMode        string     `yaml:"dsn_mode"`
+		MinLogSeverity string     `yaml:"min_log_severity"`
+		TLS            struct {
+			CAFile   string `yaml:"ca_file"`
+			CertFile string `yaml:"cert_file"`
+			KeyFile  string `yaml:"key_file"`
+		} `yaml:"tls"`
+	} `yaml:"uptrace"`
+}
+
+type fileAttribute struct {
+	Name  string `yaml:"name"`
+	Value any    `yaml:"value"`
+}
+
+type fileProcessor struct {
+	Batch *struct {
+		ScheduleDelay      *int `yaml:"schedule_delay"`
+		ExportTimeout      *int `yaml:"export_timeout"`
+		MaxQueueSize       *int `yaml:"max_queue_size"`
+		MaxExportBatchSize *int `yaml:"max_export_batch_size"`
+	} `yaml:"batch"`
+}
+
+// fileSampler maps a sampler name, for example, `parent_based`, to its arguments.
+type fileSampler map[string]*fileSamplerArgs
+
+type fileSamplerArgs struct {
+	Ratio *float64           `yaml:"ratio"`
+	Root  fileSampler        `yaml:"root"`
+	Rules []fileSamplingRule `yaml:"rules"`
+}
+
+type fileSamplingRule struct {
+	SpanName   string          `yaml:"span_name"`
+	SpanKind   string          `yaml:"span_kind"`
+	Attributes []fileAttribute `yaml:"attributes"`
+	Ratio      *float64        `yaml:"ratio"`
+	RateLimit  *float64        `yaml:"rate_limit"`
+}
+
+// stringList accepts either a single string or a list of strings.
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = stringList{value.Value}
+		return nil
+	}
+	return value.Decode((*[]string)(l))
+}
+
+// applyFile applies the settings from the YAML or JSON config file.
+func (conf *config) applyFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("can't read config file: %w", err)
+	}
+
+	var file fileConfig
+	if err := yaml.Unmarshal(expandEnv(b), &file); err != nil {
+		return fmt.Errorf("can't parse config file %q: %w", path, err)
+	}
+
+	if err := conf.applyFileConfig(&file); err != nil {
+		return fmt.Errorf("invalid config file %q: %w", path, err)
+	}
+	return nil
+}
+
+func (conf *config) applyFileConfig(file *fileConfig) error {
+	if file.Disabled != nil {
+		conf.disabled = *file.Disabled
+	}
+	if len(file.Uptrace.DSN) > 0 {
+		conf.dsn = file.Uptrace.DSN
+		conf.dsnFilePath = ""
+	}
+	if file.Uptrace.DSNFile != "" {
+		conf.dsn = nil
+		conf.dsnFilePath = file.Uptrace.DSNFile
+	}
+	if file.Uptrace.Protocol != "" {
+		protocol, err := parseProtocol(file.Uptrace.Protocol)
+		if err != nil {
+			return err
+		}
+		conf.protocol = protocol
+	}
+	if file.Uptrace.DSNMode != "" {
+		mode, err := parseDSNMode(file.Uptrace.DSNMode)
+		if err != nil {
+			return err
+		}
+		conf.dsnMode = mode
+	}
+
+	for _, attr := range file.Resource.Attributes {
+		kv, err := fileAttributeKeyValue(attr)
+		if err != nil {
+			return err
+		}
+		conf.resourceAttributes = append(conf.resourceAttributes, kv)
+	}
+	if file.Resource.AttributesList != "" {
+		for _, pair := range strings.Split(file.Resource.AttributesList, ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("invalid resource attribute: %q", pair)
+			}
+			conf.resourceAttributes = append(conf.resourceAttributes,
+				attribute.String(strings.TrimSpace(key), strings.TrimSpace(value)))
+		}
+	}
+
+	propagators := file.Propagator.Composite
+	if file.Propagator.CompositeList != "" {
+		propagators = append(propagators, strings.Split(file.Propagator.CompositeList, ",")...)
+	}
+	if len(propagators) > 0 {
+		propagator, err := newTextMapPropagator(propagators)
+		if err != nil {
+			return err
+		}
+		conf.textMapPropagator = propagator
+	}
+
+	if len(file.TracerProvider.Sampler) > 0 {
+		sampler, err := file.TracerProvider.Sampler.sampler()
+		if err != nil {
+			return err
+		}
+		conf.traceSampler = sampler
+	}
+	for i, p := range file.TracerProvider.Processors {
+		if err := p.apply(&conf.spanBatch, fmt.Sprintf("tracer_provider.processors[%d]", i)); err != nil {
+			return err
+		}
+	}
+
+	for _, reader := range file.MeterProvider.Readers {
+		if reader.Periodic != nil && reader.Periodic.Interval != nil {
+			conf.metricInterval = millis(*reader.Periodic.Interval)
+		}
+	}
+
+	for i, p := range file.LoggerProvider.Processors {
+		if err := p.apply(&conf.logBatch, fmt.Sprintf("logger_provider.processors[%d]", i)); err != nil {
+			return err
+		}
+	}
+	if file.Uptrace.MinLogSeverity != "" {
+		sev, err := parseSeverity(file.Uptrace.MinLogSeverity)
+		if err != nil {
+			return err
+		}
+		conf.logMinSeverity = sev
+	}
+
+	if tls := file.Uptrace.TLS; tls.CAFile != "" || tls.CertFile != "" || tls.KeyFile != "" {
+		conf.tlsFiles = tlsFiles{
+			caFile:   tls.CAFile,
+			certFile: tls.CertFile,
+			keyFile:  tls.KeyFile,
+		}
+	}
+
+	return nil
+}
+
+// apply applies the batch processor settings. Like the env vars,
+// the settings must be positive.
+func (p *fileProcessor) apply(batch *batchConfig, key string) error {
+	if p.Batch == nil {
+		return nil
+	}
+
+	for _, field := range []struct {
+		name  string
+		value *int
+	}{
+		{"schedule_delay", p.Batch.ScheduleDelay},
+		{"export_timeout", p.Batch.ExportTimeout},
+		{"max_queue_size", p.Batch.MaxQueueSize},
+		{"max_export_batch_size", p.Batch.MaxExportBatchSize},
+	} {
+		if field.value != nil && *field.value <= 0 {
+			return fmt.Errorf("%s.batch.%s must be a positive integer, got %d",
+				key, field.name, *field.value)
+		}
+	}
+
+	if p.Batch.ScheduleDelay != nil {
+		batch.scheduleDelay = millis(*p.Batch.ScheduleDelay)
+	}
+	if p.Batch.ExportTimeout != nil {
+		batch.exportTimeout = millis(*p.Batch.ExportTimeout)
+	}
+	if p.Batch.MaxQueueSize != nil {
+		batch.maxQueueSize = *p.Batch.MaxQueueSize
+	}
+	if p.Batch.MaxExportBatchSize != nil {
+		batch.maxExportBatchSize = *p.Batch.MaxExportBatchSize
+	}
+	return nil
+}
+
+func (s fileSampler) sampler() (sdktrace.Sampler, error) {
+	if len(s) != 1 {
+		return nil, fmt.Errorf("sampler must have exactly one type, got %d", len(s))
+	}
+
+	var name string
+	var args *fileSamplerArgs
+	for name, args = range s {
+	}
+	if args == nil {
+		args = new(fileSamplerArgs)
+	}
+
+	switch name {
+	case "always_on":
+		return sdktrace.AlwaysSample(), nil
+	case "always_off":
+		return sdktrace.NeverSample(), nil
+	case "trace_id_ratio_based":
+		ratio := 1.0
+		if args.Ratio != nil {
+			ratio = *args.Ratio
+		}
+		return sdktrace.TraceIDRatioBased(ratio), nil
+	case "parent_based":
+		root := sdktrace.AlwaysSample()
+		if len(args.Root) > 0 {
+			var err error
+			root, err = args.Root.sampler()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return sdktrace.ParentBased(root), nil
+	case "rule_based":
+		return newFileRuleBasedSampler(args.Rules)
+	default:
+		return nil, fmt.Errorf("unsupported sampler: %q", name)
+	}
+}
+
+func newFileRuleBasedSampler(fileRules []fileSamplingRule) (sdktrace.Sampler, error) {
+	rules := make([]SamplingRule, len(fileRules))
+	for i := range fileRules {
+		rule, err := fileRules[i].rule()
+		if err != nil {
+			return nil, err
+		}
+		rules[i] = rule
+	}
+	return NewRuleBasedSampler(rules...), nil
+}
+
+func (r *fileSamplingRule) rule() (SamplingRule, error) {
+	rule := SamplingRule{
+		SpanName: r.SpanName,
+	}
+	if r.SpanKind != "" {
+		kind, err := parseSpanKind(r.SpanKind)
+		if err != nil {
+			return rule, err
+		}
+		rule.SpanKind = kind
+	}
+	for _, attr := range r.Attributes {
+		kv, err := fileAttributeKeyValue(attr)
+		if err != nil {
+			return rule, err
+		}
+		rule.Attributes = append(rule.Attributes, kv)
+	}
+
+	switch {
+	case r.RateLimit != nil:
+		if *r.RateLimit <= 0 {
+			return rule, fmt.Errorf("rate_limit must be positive, got %g", *r.RateLimit)
+		}
+		rule.RateLimit = *r.RateLimit
+	case r.Ratio != nil:
+		if *r.Ratio < 0 || *r.Ratio > 1 {
+			return rule, fmt.Errorf("ratio must be between 0 and 1, got %g", *r.Ratio)
+		}
+		rule.Ratio = *r.Ratio
+	default:
+		return rule, errors.New("sampling rule must have ratio or rate_limit")
+	}
+	return rule, nil
+}
+
+func fileAttributeKeyValue(attr fileAttribute) (attribute.KeyValue, error) {
+	key := attribute.Key(attr.Name)
+	switch value := attr.Value.(type) {
+	case string:
+		return key.String(value), nil
+	case bool:
+		return key.Bool(value), nil
+	case int:
+		return key.Int(value), nil
+	case float64:
+		return key.Float64(value), nil
+	default:
+		return attribute.KeyValue{}, fmt.Errorf(
+			"unsupported value of attribute %q: %v", attr.Name, attr.Value)
+	}
+}
+
+func millis(n int) time.Duration {
+	return time.Duration(n) * time.Millisecond
+}
+
+// parseSeverity parses a severity name such as `info`, `warn2`, or `error`.
+func parseSeverity(s string) (log.Severity, error) {
+	name := strings.ToUpper(s)
+	if name == "WARNING" {
+		name = "WARN"
+	}
+	for sev := log.SeverityTrace1; sev <= log.SeverityFatal4; sev++ {
+		if sev.String() == name {
+			return sev, nil
+		}
+	}
+	return log.SeverityUndefined, fmt.Errorf("unknown log severity: %q", s)
+}
+
+var envVarRE = regexp.MustCompile(`\$\{(?:env:)?([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// expandEnv replaces `${VAR}` and `${VAR:-default}` with the env var values
+// as described in the OpenTelemetry file configuration specification.
+func expandEnv(b []byte) []byte {
+	return envVarRE.ReplaceAllFunc(b, func(match []byte) []byte {
+		sub := envVarRE.FindSubmatch(match)
+		if value, ok := os.LookupEnv(string(sub[1])); ok && value != "" {
+			return []byte(value)
+		}
+		return sub[2]
+	})
+}
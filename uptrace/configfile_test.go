@@ -0,0 +1,166 @@
+package uptrace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/log"
+)
+
+func TestConfigFile(t *testing.T) {
+	t.Setenv("UPTRACE_DSN", "")
+	t.Setenv("TEST_UPTRACE_DSN", "https://token@uptrace.dev/1")
+
+	path := filepath.Join(t.TempDir(), "uptrace.yml")
+	err := os.WriteFile(path, []byte(`
+file_format: "0.3"
+resource:
+  attributes:
+    - name: service.name
+      value: myservice
+    - name: service.replicas
+      value: 3
+  attributes_list: deployment.environment=prod
+propagator:
+  composite: [tracecontext]
+tracer_provider:
+  sampler:
+    parent_based:
+      root:
+        trace_id_ratio_based:
+          ratio: 0.5
+  processors:
+    - batch:
+        schedule_delay: 5000
+        max_queue_size: 2048
+        max_export_batch_size: 512
+meter_provider:
+  readers:
+    - periodic:
+        interval: 30000
+logger_provider:
+  processors:
+    - batch:
+        export_timeout: 1000
+uptrace:
+  dsn: ${TEST_UPTRACE_DSN}
+  dsn_mode: failover
+  min_log_severity: warn
+`), 0o600)
+	require.NoError(t, err)
+
+	conf, err := newConfig([]Option{
+		WithConfigFile(path),
+		WithServiceName("override"),
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"https://token@uptrace.dev/1"}, conf.dsn)
+	require.Equal(t, []attribute.KeyValue{
+		attribute.String("service.name", "myservice"),
+		attribute.Int("service.replicas", 3),
+		attribute.String("deployment.environment", "prod"),
+		attribute.String("service.name", "override"),
+	}, conf.resourceAttributes)
+	require.ElementsMatch(t, []string{"traceparent", "tracestate"}, conf.textMapPropagator.Fields())
+	require.Equal(t,
+		"ParentBased{root:TraceIDRatioBased{0.5},remoteParentSampled:AlwaysOnSampler,"+
+			"remoteParentNotSampled:AlwaysOffSampler,localParentSampled:AlwaysOnSampler,"+
+			"localParentNotSampled:AlwaysOffSampler}",
+		conf.traceSampler.Description())
+	require.Equal(t, 5*time.Second, conf.spanBatch.scheduleDelay)
+	require.Equal(t, 2048, conf.spanBatch.maxQueueSize)
+	require.Equal(t, 512, conf.spanBatch.maxExportBatchSize)
+	require.Equal(t, 30*time.Second, conf.metricInterval)
+	require.Equal(t, time.Second, conf.logBatch.exportTimeout)
+	require.Equal(t, log.SeverityWarn1, conf.logMinSeverity)
+	require.Equal(t, DSNFailover, conf.dsnMode)
+}
+
+func TestConfigFileRuleBasedSampler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uptrace.yml")
+	err := os.WriteFile(path, []byte(`
+tracer_provider:
+  sampler:
+    parent_based:
+      root:
+        rule_based:
+          rules:
+            - attributes:
+                - name: http.route
+                  value: /healthz
+              ratio: 0
+            - span_name: POST /checkout
+              span_kind: server
+              ratio: 1
+            - span_kind: consumer
+              rate_limit: 10
+            - ratio: 0.05
+`), 0o600)
+	require.NoError(t, err)
+
+	conf, err := newConfig([]Option{WithConfigFile(path)})
+	require.NoError(t, err)
+	require.Contains(t, conf.traceSampler.Description(),
+		"root:RuleBasedSampler{TraceIDRatioBased{0},TraceIDRatioBased{1},"+
+			"RateLimitingSampler{10},TraceIDRatioBased{0.05}}")
+
+	err = os.WriteFile(path, []byte(`
+tracer_provider:
+  sampler:
+    rule_based:
+      rules:
+        - span_kind: server
+`), 0o600)
+	require.NoError(t, err)
+
+	_, err = newConfig([]Option{WithConfigFile(path)})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "sampling rule must have ratio or rate_limit")
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := newConfig([]Option{WithConfigFile(filepath.Join(dir, "missing.yml"))})
+	require.Error(t, err)
+
+	path := filepath.Join(dir, "uptrace.json")
+	err = os.WriteFile(path, []byte(`{"tracer_provider": {"sampler": {"jaeger_remote": {}}}}`), 0o600)
+	require.NoError(t, err)
+
+	_, err = newConfig([]Option{WithConfigFile(path)})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `unsupported sampler: "jaeger_remote"`)
+
+	for _, test := range []struct {
+		config string
+		err    string
+	}{
+		{
+			`{"tracer_provider": {"processors": [{"batch": {"schedule_delay": 0}}]}}`,
+			"tracer_provider.processors[0].batch.schedule_delay must be a positive integer, got 0",
+		},
+		{
+			`{"tracer_provider": {"processors": [{"batch": {"export_timeout": -1}}]}}`,
+			"tracer_provider.processors[0].batch.export_timeout must be a positive integer, got -1",
+		},
+		{
+			`{"logger_provider": {"processors": [{}, {"batch": {"max_queue_size": 0}}]}}`,
+			"logger_provider.processors[1].batch.max_queue_size must be a positive integer, got 0",
+		},
+		{
+			`{"logger_provider": {"processors": [{"batch": {"max_export_batch_size": -5}}]}}`,
+			"logger_provider.processors[0].batch.max_export_batch_size must be a positive integer, got -5",
+		},
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(test.config), 0o600))
+		_, err = newConfig([]Option{WithConfigFile(path)})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), test.err)
+	}
+}
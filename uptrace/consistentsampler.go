@@ -0,0 +1,311 @@
+package uptrace
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// otTraceStateKey is the tracestate key reserved for OpenTelemetry.
+	otTraceStateKey = "ot"
+
+	// The randomness and the threshold are 56-bit values.
+	randomnessBits = 56
+	maxThreshold   = uint64(1) << randomnessBits
+	randomnessMask = maxThreshold - 1
+
+	// thresholdPrecision is the number of significant hex digits in the encoded threshold.
+	thresholdPrecision = 4
+)
+
+// consistentSampler implements the consistent probability sampling using
+// the `th` threshold and `rv` randomness values in the W3C tracestate `ot` entry.
+type consistentSampler struct {
+	ratio       float64
+	threshold   uint64
+	th          string
+	probability float64
+}
+
+var _ sdktrace.Sampler = (*consistentSampler)(nil)
+
+// NewConsistentProbabilitySampler returns a sampler that samples the ratio of traces
+// consistently across services using the W3C tracestate `ot` entry as described
+// in the OpenTelemetry probability sampling specification.
+//
+// The sampler compares the randomness, which is either the `rv` tracestate value or
+// the least significant 56 bits of the trace ID, with the rejection threshold derived
+// from the ratio. Sampled spans record the threshold using the `th` tracestate value
+// and the sampling probability using the SamplingProbabilityKey attribute so Uptrace
+// can compute adjusted counts.
+//
+// Like NewRateLimitingSampler, the sampler ignores the parent sampling decision so
+// it is usually wrapped with sdktrace.ParentBased.
+func NewConsistentProbabilitySampler(ratio float64) sdktrace.Sampler {
+	s := &consistentSampler{
+		ratio: ratio,
+	}
+	s.threshold = probabilityThreshold(ratio)
+	if s.threshold < maxThreshold {
+		s.th = encodeThreshold(s.threshold)
+		s.probability = thresholdProbability(s.threshold)
+	}
+	return s
+}
+
+func (s *consistentSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	psc := trace.SpanContextFromContext(p.ParentContext)
+	state := psc.TraceState()
+	ot := parseOTTraceState(state.Get(otTraceStateKey))
+
+	randomness, ok := ot.randomness()
+	if !ok {
+		randomness = traceIDRandomness(p.TraceID)
+	}
+
+	if s.threshold < maxThreshold && randomness >= s.threshold {
+		ot.set("th", s.th)
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.RecordAndSample,
+			Attributes: []attribute.KeyValue{SamplingProbabilityKey.Float64(s.probability)},
+			Tracestate: ot.update(state),
+		}
+	}
+
+	// The threshold must not be propagated with unsampled spans.
+	ot.delete("th")
+	return sdktrace.SamplingResult{
+		Decision:   sdktrace.Drop,
+		Tracestate: ot.update(state),
+	}
+}
+
+func (s *consistentSampler) Description() string {
+	return fmt.Sprintf("ConsistentProbabilitySampler{%g}", s.ratio)
+}
+
+// NewParentBasedConsistentProbabilitySampler returns a sampler that samples the ratio
+// of new root traces using NewConsistentProbabilitySampler. Child spans follow the
+// sampling decision of their parent span and record the sampling probability derived
+// from the parent's `th` tracestate value.
+func NewParentBasedConsistentProbabilitySampler(ratio float64) sdktrace.Sampler {
+	parent := parentThresholdSampler{}
+	return sdktrace.ParentBased(NewConsistentProbabilitySampler(ratio),
+		sdktrace.WithRemoteParentSampled(parent),
+		sdktrace.WithLocalParentSampled(parent),
+	)
+}
+
+// parentThresholdSampler samples spans with a sampled parent and records
+// the sampling probability using the parent's threshold.
+type parentThresholdSampler struct{}
+
+func (parentThresholdSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	state := trace.SpanContextFromContext(p.ParentContext).TraceState()
+	ot := parseOTTraceState(state.Get(otTraceStateKey))
+
+	var attrs []attribute.KeyValue
+	if threshold, ok := ot.threshold(); ok {
+		attrs = append(attrs, SamplingProbabilityKey.Float64(thresholdProbability(threshold)))
+	} else {
+		// The invalid threshold must be erased.
+		ot.delete("th")
+	}
+
+	return sdktrace.SamplingResult{
+		Decision:   sdktrace.RecordAndSample,
+		Attributes: attrs,
+		Tracestate: ot.update(state),
+	}
+}
+
+func (parentThresholdSampler) Description() string {
+	return "ParentThresholdSampler"
+}
+
+// traceIDRandomness returns the least significant 56 bits of the trace ID.
+// The time-ordered trace IDs generated by Uptrace have random low bytes.
+func traceIDRandomness(traceID trace.TraceID) uint64 {
+	return binary.BigEndian.Uint64(traceID[8:]) & randomnessMask
+}
+
+// probabilityThreshold returns the rejection threshold for the probability,
+// rounded to thresholdPrecision significant hex digits. The returned threshold
+// is maxThreshold when nothing should be sampled.
+func probabilityThreshold(probability float64) uint64 {
+	if !(probability > 0) {
+		return maxThreshold
+	}
+	if probability >= 1 {
+		return 0
+	}
+
+	threshold := maxThreshold - uint64(math.Round(probability*float64(maxThreshold)))
+	if threshold == 0 {
+		return 0
+	}
+
+	// Thresholds close to 0 and to maxThreshold need more digits to keep the precision,
+	// for example, 0.00001 is encoded as `ffff583a`.
+	v := min(threshold, maxThreshold-threshold)
+	leadingZeros := (bits.LeadingZeros64(v) - (64 - randomnessBits)) / 4
+	digits := min(leadingZeros+thresholdPrecision, randomnessBits/4)
+	shift := uint(4 * (randomnessBits/4 - digits))
+	if shift > 0 {
+		threshold = (threshold + (1 << (shift - 1))) >> shift << shift
+	}
+	return threshold
+}
+
+func thresholdProbability(threshold uint64) float64 {
+	return float64(maxThreshold-threshold) / float64(maxThreshold)
+}
+
+// encodeThreshold encodes the threshold as 14 hex digits removing trailing zeros.
+func encodeThreshold(threshold uint64) string {
+	if threshold == 0 {
+		return "0"
+	}
+	s := fmt.Sprintf("%014x", threshold)
+	return strings.TrimRight(s, "0")
+}
+
+// parseThreshold parses the `th` tracestate value.
+func parseThreshold(s string) (uint64, error) {
+	if s == "" || len(s) > randomnessBits/4 {
+		return 0, fmt.Errorf("invalid threshold: %q", s)
+	}
+	n, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid threshold: %q", s)
+	}
+	return n << uint(4*(randomnessBits/4-len(s))), nil
+}
+
+// parseRandomness parses the `rv` tracestate value.
+func parseRandomness(s string) (uint64, error) {
+	if len(s) != randomnessBits/4 {
+		return 0, fmt.Errorf("invalid randomness: %q", s)
+	}
+	n, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid randomness: %q", s)
+	}
+	return n, nil
+}
+
+//------------------------------------------------------------------------------
+
+// otTraceState is the value of the `ot` tracestate entry, for example, `th:8;rv:1a2b...`.
+// Unknown values are preserved.
+type otTraceState struct {
+	values []otValue
+}
+
+type otValue struct {
+	key, value string
+}
+
+func parseOTTraceState(s string) *otTraceState {
+	ot := new(otTraceState)
+	if s == "" {
+		return ot
+	}
+	for _, pair := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(pair, ":")
+		if !ok || key == "" {
+			// Drop the invalid value so it is not propagated further.
+			ot.values = nil
+			return ot
+		}
+		ot.values = append(ot.values, otValue{key: key, value: value})
+	}
+	return ot
+}
+
+func (ot *otTraceState) get(key string) (string, bool) {
+	for _, v := range ot.values {
+		if v.key == key {
+			return v.value, true
+		}
+	}
+	return "", false
+}
+
+func (ot *otTraceState) set(key, value string) {
+	for i := range ot.values {
+		if ot.values[i].key == key {
+			ot.values[i].value = value
+			return
+		}
+	}
+	ot.values = append(ot.values, otValue{key: key, value: value})
+}
+
+func (ot *otTraceState) delete(key string) {
+	for i := range ot.values {
+		if ot.values[i].key == key {
+			ot.values = append(ot.values[:i], ot.values[i+1:]...)
+			return
+		}
+	}
+}
+
+// randomness returns the valid `rv` value.
+func (ot *otTraceState) randomness() (uint64, bool) {
+	s, ok := ot.get("rv")
+	if !ok {
+		return 0, false
+	}
+	rv, err := parseRandomness(s)
+	if err != nil {
+		return 0, false
+	}
+	return rv, true
+}
+
+// threshold returns the valid `th` value.
+func (ot *otTraceState) threshold() (uint64, bool) {
+	s, ok := ot.get("th")
+	if !ok {
+		return 0, false
+	}
+	th, err := parseThreshold(s)
+	if err != nil {
+		return 0, false
+	}
+	return th, true
+}
+
+func (ot *otTraceState) String() string {
+	var b strings.Builder
+	for i, v := range ot.values {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		b.WriteString(v.key)
+		b.WriteByte(':')
+		b.WriteString(v.value)
+	}
+	return b.String()
+}
+
+// update returns the tracestate with the updated `ot` entry.
+func (ot *otTraceState) update(state trace.TraceState) trace.TraceState {
+	if len(ot.values) == 0 {
+		return state.Delete(otTraceStateKey)
+	}
+	updated, err := state.Insert(otTraceStateKey, ot.String())
+	if err != nil {
+		return state.Delete(otTraceStateKey)
+	}
+	return updated
+}
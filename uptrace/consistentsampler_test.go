@@ -0,0 +1,149 @@
+package uptrace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestProbabilityThreshold(t *testing.T) {
+	tests := []struct {
+		probability float64
+		th          string
+	}{
+		{1, "0"},
+		{0.5, "8"},
+		{0.25, "c"},
+		{0.1, "e666"},
+		{0.001, "ffbe77"},
+		{0.00001, "ffff583a"},
+		{0.99999, "0000a7c6"},
+	}
+	for _, test := range tests {
+		threshold := probabilityThreshold(test.probability)
+		require.Equal(t, test.th, encodeThreshold(threshold), test.probability)
+
+		parsed, err := parseThreshold(test.th)
+		require.NoError(t, err)
+		require.Equal(t, threshold, parsed)
+		require.InEpsilon(t, test.probability, thresholdProbability(threshold), 0.001)
+	}
+
+	require.Equal(t, maxThreshold, probabilityThreshold(0))
+	require.Equal(t, maxThreshold, probabilityThreshold(1e-18))
+
+	for _, s := range []string{"", "g", "123456789abcdef"} {
+		_, err := parseThreshold(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestOTTraceState(t *testing.T) {
+	ot := parseOTTraceState("rv:0123456789abcd;x:y")
+	rv, ok := ot.randomness()
+	require.True(t, ok)
+	require.Equal(t, uint64(0x0123456789abcd), rv)
+
+	ot.set("th", "8")
+	require.Equal(t, "rv:0123456789abcd;x:y;th:8", ot.String())
+	ot.delete("rv")
+	require.Equal(t, "x:y;th:8", ot.String())
+
+	_, ok = parseOTTraceState("rv:123").randomness()
+	require.False(t, ok)
+	require.Equal(t, "", parseOTTraceState("th").String())
+}
+
+func TestConsistentProbabilitySampler(t *testing.T) {
+	sampler := NewConsistentProbabilitySampler(0.5)
+	require.Equal(t, "ConsistentProbabilitySampler{0.5}", sampler.Description())
+
+	sample := func(traceID trace.TraceID, tracestate string) sdktrace.SamplingResult {
+		ctx := context.Background()
+		if tracestate != "" {
+			state, err := trace.ParseTraceState(tracestate)
+			require.NoError(t, err)
+			ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID:    traceID,
+				SpanID:     trace.SpanID{1},
+				TraceState: state,
+				Remote:     true,
+			}))
+		}
+		return sampler.ShouldSample(sdktrace.SamplingParameters{
+			ParentContext: ctx,
+			TraceID:       traceID,
+		})
+	}
+
+	// The randomness is taken from the low 56 bits of the trace ID.
+	res := sample(trace.TraceID{8: 0x00, 9: 0x80}, "")
+	require.Equal(t, sdktrace.RecordAndSample, res.Decision)
+	require.Equal(t, "ot=th:8", res.Tracestate.String())
+	require.Equal(t, SamplingProbabilityKey.Float64(0.5), res.Attributes[0])
+
+	res = sample(trace.TraceID{8: 0xff, 9: 0x7f, 15: 0xff}, "")
+	require.Equal(t, sdktrace.Drop, res.Decision)
+	require.Equal(t, "", res.Tracestate.String())
+
+	// The explicit randomness takes precedence over the trace ID.
+	res = sample(trace.TraceID{9: 0xff}, "ot=rv:7fffffffffffff;th:0,vendor=value")
+	require.Equal(t, sdktrace.Drop, res.Decision)
+	require.Equal(t, "ot=rv:7fffffffffffff,vendor=value", res.Tracestate.String())
+
+	res = sample(trace.TraceID{}, "vendor=value,ot=rv:80000000000000;th:c")
+	require.Equal(t, sdktrace.RecordAndSample, res.Decision)
+	require.Equal(t, "ot=rv:80000000000000;th:8,vendor=value", res.Tracestate.String())
+
+	res = NewConsistentProbabilitySampler(0).ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: context.Background(),
+		TraceID:       trace.TraceID{8: 0xff, 9: 0xff},
+	})
+	require.Equal(t, sdktrace.Drop, res.Decision)
+}
+
+func TestParentBasedConsistentProbabilitySampler(t *testing.T) {
+	ctx := context.Background()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(NewParentBasedConsistentProbabilitySampler(0.25)),
+		sdktrace.WithSpanProcessor(recorder),
+	)
+	defer provider.Shutdown(ctx)
+	tracer := provider.Tracer("test")
+
+	// The remote parent was sampled with 50% probability in another service.
+	state, err := trace.ParseTraceState("ot=th:8")
+	require.NoError(t, err)
+	ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+		TraceState: state,
+		Remote:     true,
+	}))
+
+	ctx, span := tracer.Start(ctx, "server")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	span.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	for _, span := range spans {
+		require.Equal(t, "ot=th:8", span.SpanContext().TraceState().String())
+
+		var probability float64
+		for _, kv := range span.Attributes() {
+			if kv.Key == SamplingProbabilityKey {
+				probability = kv.Value.AsFloat64()
+			}
+		}
+		require.Equal(t, 0.5, probability)
+	}
+}
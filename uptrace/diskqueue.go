@@ -0,0 +1,632 @@
+package uptrace
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptrace/uptrace-go/internal"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	diskQueueMagic         = "UTQ1"
+	diskQueueSegmentExt    = ".seg"
+	diskQueueTempExt       = ".tmp"
+	diskQueueReplayTimeout = 30 * time.Second
+
+	defaultDiskQueueMaxBytes = 100 << 20
+)
+
+var errRequestTooLarge = errors.New("OTLP request is larger than the disk queue")
+
+// queueSegment is an OTLP export request stored on disk.
+//
+// A segment file consists of the magic, the CRC32 checksum of the rest of the file,
+// the length of the JSON-encoded segment metadata, the metadata, and the request body.
+type queueSegment struct {
+	Protocol Protocol `json:"protocol"`
+	// Target is the request URL for OTLP/HTTP and the method name for OTLP/gRPC.
+	Target string              `json:"target"`
+	Header map[string][]string `json:"header,omitempty"`
+
+	body []byte
+}
+
+func (seg *queueSegment) encode() ([]byte, error) {
+	meta, err := json.Marshal(seg)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 12, 12+len(meta)+len(seg.body))
+	copy(b, diskQueueMagic)
+	binary.BigEndian.PutUint32(b[8:], uint32(len(meta)))
+	b = append(b, meta...)
+	b = append(b, seg.body...)
+	binary.BigEndian.PutUint32(b[4:], crc32.ChecksumIEEE(b[8:]))
+
+	return b, nil
+}
+
+func decodeQueueSegment(b []byte) (*queueSegment, error) {
+	if len(b) < 12 || string(b[:4]) != diskQueueMagic {
+		return nil, errors.New("invalid segment header")
+	}
+	if crc32.ChecksumIEEE(b[8:]) != binary.BigEndian.Uint32(b[4:]) {
+		return nil, errors.New("segment checksum mismatch")
+	}
+
+	metaLen := int(binary.BigEndian.Uint32(b[8:]))
+	if metaLen > len(b)-12 {
+		return nil, errors.New("invalid segment metadata length")
+	}
+
+	seg := new(queueSegment)
+	if err := json.Unmarshal(b[12:12+metaLen], seg); err != nil {
+		return nil, fmt.Errorf("invalid segment metadata: %w", err)
+	}
+	seg.body = b[12+metaLen:]
+
+	return seg, nil
+}
+
+//------------------------------------------------------------------------------
+
+type diskQueueFile struct {
+	name string
+	size int64
+}
+
+// diskQueue persists OTLP export requests that could not be delivered and replays
+// them in order once the endpoint becomes reachable again.
+type diskQueue struct {
+	dir      string
+	maxBytes int64
+
+	httpTransport http.RoundTripper
+	grpcConn      *grpc.ClientConn
+	// headers returns the uptrace-dsn header and the headers configured with
+	// WithHeaders. They are removed from the queued requests and added to
+	// the replayed requests instead of persisting the token and credentials on disk.
+	headers func(ctx context.Context) map[string]string
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu    sync.Mutex
+	files []diskQueueFile
+	size  int64
+	seq   uint64
+
+	wakeCh  chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	doneCh  chan struct{}
+	started bool
+}
+
+func newDiskQueue(dir string, maxBytes int64) (*diskQueue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("can't create disk queue dir: %w", err)
+	}
+
+	q := &diskQueue{
+		dir:      dir,
+		maxBytes: maxBytes,
+
+		minBackoff: time.Second,
+		maxBackoff: time.Minute,
+
+		wakeCh: make(chan struct{}, 1),
+		doneCh: make(chan struct{}),
+	}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// load loads the segments left by the previous process.
+func (q *diskQueue) load() error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return fmt.Errorf("can't read disk queue dir: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		switch filepath.Ext(name) {
+		case diskQueueTempExt:
+			_ = os.Remove(filepath.Join(q.dir, name))
+		case diskQueueSegmentExt:
+			seq, err := strconv.ParseUint(strings.TrimSuffix(name, diskQueueSegmentExt), 10, 64)
+			if err != nil {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+
+			q.files = append(q.files, diskQueueFile{name: name, size: info.Size()})
+			q.size += info.Size()
+			if seq >= q.seq {
+				q.seq = seq + 1
+			}
+		}
+	}
+
+	sort.Slice(q.files, func(i, j int) bool {
+		return q.files[i].name < q.files[j].name
+	})
+	for q.size > q.maxBytes && len(q.files) > 0 {
+		q.evictOldest()
+	}
+
+	return nil
+}
+
+func (q *diskQueue) start() {
+	q.started = true
+	go q.run()
+}
+
+// Close stops replaying the segments. The segments are kept on disk
+// and are replayed when the queue is opened again.
+func (q *diskQueue) Close() error {
+	q.cancel()
+	if q.started {
+		<-q.doneCh
+	}
+	return nil
+}
+
+func (q *diskQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.files)
+}
+
+func (q *diskQueue) enqueue(seg *queueSegment) error {
+	b, err := seg.encode()
+	if err != nil {
+		return err
+	}
+	if int64(len(b)) > q.maxBytes {
+		internal.Logger.Printf("disk queue: dropping OTLP request (%d bytes exceed the limit of %d bytes)",
+			len(b), q.maxBytes)
+		return errRequestTooLarge
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.size+int64(len(b)) > q.maxBytes && len(q.files) > 0 {
+		q.evictOldest()
+	}
+
+	name := fmt.Sprintf("%020d%s", q.seq, diskQueueSegmentExt)
+	q.seq++
+
+	path := filepath.Join(q.dir, name)
+	if err := writeFileSync(path+diskQueueTempExt, b); err != nil {
+		_ = os.Remove(path + diskQueueTempExt)
+		return fmt.Errorf("can't write disk queue segment: %w", err)
+	}
+	if err := os.Rename(path+diskQueueTempExt, path); err != nil {
+		return fmt.Errorf("can't write disk queue segment: %w", err)
+	}
+	// Sync the dir so the renamed segment survives a crash.
+	if err := syncDir(q.dir); err != nil {
+		return fmt.Errorf("can't write disk queue segment: %w", err)
+	}
+
+	q.files = append(q.files, diskQueueFile{name: name, size: int64(len(b))})
+	q.size += int64(len(b))
+
+	select {
+	case q.wakeCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// writeFileSync writes the file and flushes it to disk.
+func writeFileSync(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		// Directories can't be synced on Windows.
+		return nil
+	}
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// evictOldest removes the oldest segment to free space. The caller must hold the lock.
+func (q *diskQueue) evictOldest() {
+	file := q.files[0]
+	internal.Logger.Printf("disk queue is full: dropping %d bytes", file.size)
+	q.removeLocked(file)
+}
+
+func (q *diskQueue) head() (diskQueueFile, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.files) == 0 {
+		return diskQueueFile{}, false
+	}
+	return q.files[0], true
+}
+
+func (q *diskQueue) remove(file diskQueueFile) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.removeLocked(file)
+}
+
+func (q *diskQueue) removeLocked(file diskQueueFile) {
+	for i := range q.files {
+		if q.files[i].name == file.name {
+			q.files = append(q.files[:i], q.files[i+1:]...)
+			q.size -= file.size
+			_ = os.Remove(filepath.Join(q.dir, file.name))
+			return
+		}
+	}
+}
+
+func (q *diskQueue) run() {
+	defer close(q.doneCh)
+
+	backoff := q.minBackoff
+	for {
+		file, ok := q.head()
+		if !ok {
+			select {
+			case <-q.wakeCh:
+				continue
+			case <-q.ctx.Done():
+				return
+			}
+		}
+
+		if err := q.replay(file); err == nil {
+			backoff = q.minBackoff
+			continue
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-q.ctx.Done():
+			return
+		}
+		backoff = min(2*backoff, q.maxBackoff)
+	}
+}
+
+// replay sends the segment and removes it unless the error is temporary.
+func (q *diskQueue) replay(file diskQueueFile) error {
+	if file.size > q.maxBytes {
+		internal.Logger.Printf("disk queue: dropping oversized segment %s (%d bytes)", file.name, file.size)
+		q.remove(file)
+		return nil
+	}
+
+	b, err := os.ReadFile(filepath.Join(q.dir, file.name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			q.remove(file)
+			return nil
+		}
+		return err
+	}
+
+	seg, err := decodeQueueSegment(b)
+	if err != nil {
+		internal.Logger.Printf("disk queue: dropping corrupted segment %s: %s", file.name, err)
+		q.remove(file)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(q.ctx, diskQueueReplayTimeout)
+	defer cancel()
+
+	if err := q.send(ctx, seg); err != nil {
+		var permanent *permanentError
+		if !errors.As(err, &permanent) {
+			return err
+		}
+		internal.Logger.Printf("disk queue: dropping segment %s: %s", file.name, err)
+	}
+
+	q.remove(file)
+	return nil
+}
+
+func (q *diskQueue) send(ctx context.Context, seg *queueSegment) error {
+	switch seg.Protocol {
+	case ProtocolGRPC:
+		if q.grpcConn == nil {
+			return &permanentError{errors.New("OTLP/gRPC is not configured")}
+		}
+		return q.sendGRPC(ctx, seg)
+	default:
+		if q.httpTransport == nil {
+			return &permanentError{errors.New("OTLP/HTTP is not configured")}
+		}
+		return q.sendHTTP(ctx, seg)
+	}
+}
+
+// configHeaders returns the headers that are added when the requests are replayed
+// so they are not persisted.
+func (q *diskQueue) configHeaders(ctx context.Context) map[string]string {
+	if q.headers == nil {
+		return nil
+	}
+	return q.headers(ctx)
+}
+
+func (q *diskQueue) sendHTTP(ctx context.Context, seg *queueSegment) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, seg.Target, bytes.NewReader(seg.body))
+	if err != nil {
+		return &permanentError{err}
+	}
+	if seg.Header != nil {
+		req.Header = seg.Header
+	}
+	for k, v := range q.configHeaders(ctx) {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := q.httpTransport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+
+	err = fmt.Errorf("%s responded with %s", seg.Target, resp.Status)
+	if isTemporaryHTTPStatus(resp.StatusCode) {
+		return err
+	}
+	return &permanentError{err}
+}
+
+func (q *diskQueue) sendGRPC(ctx context.Context, seg *queueSegment) error {
+	req, resp, ok := newGRPCExportMessages(seg.Target)
+	if !ok {
+		return &permanentError{fmt.Errorf("unknown OTLP/gRPC method: %q", seg.Target)}
+	}
+	if err := proto.Unmarshal(seg.body, req); err != nil {
+		return &permanentError{err}
+	}
+
+	md := metadata.MD(seg.Header).Copy()
+	for k, v := range q.configHeaders(ctx) {
+		md.Set(k, v)
+	}
+
+	ctx = context.WithValue(ctx, diskQueueReplayKey{}, true)
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	err := q.grpcConn.Invoke(ctx, seg.Target, req, resp)
+	if err == nil || isTemporaryGRPCError(err) || errors.Is(err, ErrDSNRejected) {
+		return err
+	}
+	return &permanentError{err}
+}
+
+type diskQueueReplayKey struct{}
+
+// unaryClientInterceptor spills the requests that failed with a temporary error to disk.
+// If the queue is not empty, requests are spilled without sending to preserve the order.
+func (q *diskQueue) unaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply any,
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	msg, ok := req.(proto.Message)
+	if !ok || ctx.Value(diskQueueReplayKey{}) != nil {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	if q.pending() == 0 {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if !isTemporaryGRPCError(err) {
+			return err
+		}
+	}
+
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	for k := range q.configHeaders(ctx) {
+		md.Delete(k)
+	}
+
+	return q.enqueue(&queueSegment{
+		Protocol: ProtocolGRPC,
+		Target:   method,
+		Header:   md,
+		body:     body,
+	})
+}
+
+//------------------------------------------------------------------------------
+
+// diskQueueTransport spills the requests that failed with a temporary error to disk
+// and reports them as delivered. If the queue is not empty, requests are spilled
+// without sending to preserve the order.
+type diskQueueTransport struct {
+	queue *diskQueue
+	next  http.RoundTripper
+}
+
+func newDiskQueueTransport(queue *diskQueue, next http.RoundTripper) *diskQueueTransport {
+	queue.httpTransport = next
+	return &diskQueueTransport{
+		queue: queue,
+		next:  next,
+	}
+}
+
+func (t *diskQueueTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.queue.pending() == 0 {
+		clone := req.Clone(req.Context())
+		clone.Body = io.NopCloser(bytes.NewReader(body))
+
+		resp, err := t.next.RoundTrip(clone)
+		if err == nil && !isTemporaryHTTPStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		var permanent *permanentError
+		if errors.Is(err, ErrDSNRejected) || errors.As(err, &permanent) {
+			return nil, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+	}
+
+	header := req.Header.Clone()
+	for k := range t.queue.configHeaders(req.Context()) {
+		header.Del(k)
+	}
+
+	if err := t.queue.enqueue(&queueSegment{
+		Protocol: ProtocolHTTP,
+		Target:   req.URL.String(),
+		Header:   header,
+		body:     body,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:     "202 Accepted",
+		StatusCode: http.StatusAccepted,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	defer req.Body.Close()
+	return io.ReadAll(req.Body)
+}
+
+//------------------------------------------------------------------------------
+
+// permanentError is an export error that is not resolved by retrying.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+func isTemporaryHTTPStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+func isTemporaryGRPCError(err error) bool {
+	switch status.Code(err) {
+	case codes.Canceled,
+		codes.DeadlineExceeded,
+		codes.ResourceExhausted,
+		codes.Aborted,
+		codes.Unavailable:
+		return true
+	default:
+		return false
+	}
+}
+
+// diskQueueName returns the name of the queue dir for the DSN. The name does not
+// depend on the token so the queue survives token rotation.
+func diskQueueName(dsn *DSN) string {
+	key := dsn.Scheme + "://" + joinHostPort(dsn.Host, dsn.HTTPPort) + dsn.Path + "/" + dsn.ProjectID
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
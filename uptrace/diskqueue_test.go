@@ -0,0 +1,261 @@
+package uptrace
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDiskQueueReplay(t *testing.T) {
+	ctx := context.Background()
+
+	var down atomic.Bool
+	down.Store(true)
+
+	var mu sync.Mutex
+	var spanNames, dsns, auths []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		zr, err := gzip.NewReader(req.Body)
+		require.NoError(t, err)
+		b, err := io.ReadAll(zr)
+		require.NoError(t, err)
+
+		var exportReq collectortrace.ExportTraceServiceRequest
+		require.NoError(t, proto.Unmarshal(b, &exportReq))
+
+		mu.Lock()
+		defer mu.Unlock()
+		dsns = append(dsns, req.Header.Get("uptrace-dsn"))
+		auths = append(auths, req.Header.Get("Authorization"))
+		for _, rs := range exportReq.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					spanNames = append(spanNames, span.Name)
+				}
+			}
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	dsn := strings.Replace(srv.URL, "http://", "http://secret@", 1) + "/1"
+	client, err := New(ctx,
+		WithDSN(dsn),
+		WithDiskQueue(dir, 1<<20),
+		WithHeaders(map[string]string{"Authorization": "Bearer apikey"}),
+		WithMetricsDisabled(),
+		WithLoggingDisabled(),
+		WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	queue := client.transports[0].queue
+	tracer := client.TracerProvider().Tracer("test")
+
+	for _, name := range []string{"first", "second"} {
+		_, span := tracer.Start(ctx, name)
+		span.End()
+		require.NoError(t, client.ForceFlush(ctx))
+	}
+	require.Equal(t, 2, queue.pending())
+	time.Sleep(100 * time.Millisecond)
+
+	// The token and the configured headers are not persisted.
+	files, err := filepath.Glob(filepath.Join(queue.dir, "*.seg"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		require.NoError(t, err)
+		require.NotContains(t, string(b), "secret")
+		require.NotContains(t, string(b), "apikey")
+	}
+	require.NotContains(t, queue.dir, "secret")
+
+	down.Store(false)
+	require.Eventually(t, func() bool {
+		return queue.pending() == 0
+	}, 10*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []string{"first", "second"}, spanNames)
+	require.Equal(t, []string{dsn, dsn}, dsns)
+	require.Equal(t, []string{"Bearer apikey", "Bearer apikey"}, auths)
+}
+
+func TestDiskQueueName(t *testing.T) {
+	dsn1, err := ParseDSN("https://token1@uptrace.dev/1")
+	require.NoError(t, err)
+	dsn2, err := ParseDSN("https://token2@uptrace.dev/1")
+	require.NoError(t, err)
+	dsn3, err := ParseDSN("https://token1@uptrace.dev/2")
+	require.NoError(t, err)
+
+	require.Equal(t, diskQueueName(dsn1), diskQueueName(dsn2))
+	require.NotEqual(t, diskQueueName(dsn1), diskQueueName(dsn3))
+}
+
+func TestDiskQueueGRPC(t *testing.T) {
+	ctx := context.Background()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	traceServer := new(unavailableTraceServer)
+	traceServer.down.Store(true)
+	srv := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(srv, traceServer)
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	client, err := New(ctx,
+		WithDSN("http://token@"+ln.Addr().String()+"/1?protocol=grpc"),
+		WithDiskQueue(t.TempDir(), 1<<20),
+		WithMetricsDisabled(),
+		WithLoggingDisabled(),
+		WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	queue := client.transports[0].queue
+
+	_, span := client.TracerProvider().Tracer("test").Start(ctx, "hello")
+	span.End()
+	require.NoError(t, client.ForceFlush(ctx))
+	require.Equal(t, 1, queue.pending())
+
+	traceServer.down.Store(false)
+	require.Eventually(t, func() bool {
+		return queue.pending() == 0
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Equal(t, int32(1), traceServer.spans.Load())
+}
+
+type unavailableTraceServer struct {
+	collectortrace.UnimplementedTraceServiceServer
+
+	down  atomic.Bool
+	spans atomic.Int32
+}
+
+func (s *unavailableTraceServer) Export(
+	ctx context.Context, req *collectortrace.ExportTraceServiceRequest,
+) (*collectortrace.ExportTraceServiceResponse, error) {
+	if s.down.Load() {
+		return nil, status.Error(codes.Unavailable, "unavailable")
+	}
+	s.spans.Add(int32(len(req.ResourceSpans[0].ScopeSpans[0].Spans)))
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+func TestDiskQueueLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	queue, err := newDiskQueue(dir, 1024)
+	require.NoError(t, err)
+
+	err = queue.enqueue(&queueSegment{Target: "http://localhost/v1/traces", body: []byte("hello")})
+	require.NoError(t, err)
+
+	err = queue.enqueue(&queueSegment{body: make([]byte, 2048)})
+	require.ErrorIs(t, err, errRequestTooLarge)
+
+	// Corrupted and oversized segments are dropped on replay.
+	err = os.WriteFile(filepath.Join(dir, "00000000000000000100.seg"), []byte("garbage"), 0o600)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "00000000000000000101.tmp"), []byte("partial"), 0o600)
+	require.NoError(t, err)
+
+	queue, err = newDiskQueue(dir, 1024)
+	require.NoError(t, err)
+	require.Equal(t, 2, queue.pending())
+	require.Equal(t, uint64(101), queue.seq)
+	_, err = os.Stat(filepath.Join(dir, "00000000000000000101.tmp"))
+	require.True(t, os.IsNotExist(err))
+
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		b, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, string(b))
+	}))
+	defer srv.Close()
+
+	queue.httpTransport = http.DefaultTransport
+	for {
+		file, ok := queue.head()
+		if !ok {
+			break
+		}
+		if strings.Contains(file.name, "00000000000000000000") {
+			require.NoError(t, rewriteTarget(queue, file, srv.URL))
+		}
+		require.NoError(t, queue.replay(file))
+	}
+
+	require.Equal(t, []string{"hello"}, bodies)
+	require.Equal(t, int64(0), queue.size)
+}
+
+func rewriteTarget(queue *diskQueue, file diskQueueFile, target string) error {
+	path := filepath.Join(queue.dir, file.name)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	seg, err := decodeQueueSegment(b)
+	if err != nil {
+		return err
+	}
+	seg.Target = target
+	b, err = seg.encode()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+func TestQueueSegmentChecksum(t *testing.T) {
+	seg := &queueSegment{Protocol: ProtocolGRPC, Target: grpcTracesMethod, body: []byte("body")}
+	b, err := seg.encode()
+	require.NoError(t, err)
+
+	decoded, err := decodeQueueSegment(b)
+	require.NoError(t, err)
+	require.Equal(t, seg, decoded)
+
+	b[len(b)-1] ^= 0xff
+	_, err = decodeQueueSegment(b)
+	require.Error(t, err)
+}
+
+func TestWithDiskQueueDefaultMaxBytes(t *testing.T) {
+	conf, err := newConfig([]Option{WithDiskQueue(t.TempDir(), 0)})
+	require.NoError(t, err)
+	require.Equal(t, int64(defaultDiskQueueMaxBytes), conf.diskQueueMaxBytes)
+}
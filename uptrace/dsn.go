@@ -1,11 +1,40 @@
 package uptrace
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/url"
+	"strings"
 )
 
+// Errors returned by ParseDSN. Use errors.Is to check them.
+var (
+	ErrEmptyDSN   = errors.New("uptrace: DSN is empty")
+	ErrInvalidDSN = errors.New("uptrace: invalid DSN")
+	ErrNoScheme   = errors.New("uptrace: DSN does not have a scheme")
+	ErrNoHost     = errors.New("uptrace: DSN does not have a host")
+	ErrNoToken    = errors.New("uptrace: DSN does not have a token")
+)
+
+// dsnError describes an invalid DSN without revealing the token.
+type dsnError struct {
+	dsn    string
+	reason string
+	err    error
+}
+
+func (e *dsnError) Error() string {
+	return fmt.Sprintf("DSN=%q %s", e.dsn, e.reason)
+}
+
+func (e *dsnError) Unwrap() error {
+	return e.err
+}
+
+// DSN is a data source name that is used to connect to Uptrace, for example,
+// `https://<token>@uptrace.dev/<project_id>`.
 type DSN struct {
 	original string
 
@@ -14,17 +43,83 @@ type DSN struct {
 	HTTPPort string
 	GRPCPort string
 	Token    string
+
+	// ProjectID is the last path segment of the DSN.
+	ProjectID string
+
+	// Path is the base path of Uptrace mounted behind a reverse proxy, for example,
+	// `/uptrace` in `https://<token>@infra.example.com/uptrace/<project_id>`.
+	// It is applied to the OTLP/HTTP paths and the site URL.
+	Path string
+
+	// Protocol is the OTLP protocol set with the `protocol` query param, for example,
+	// `https://<token>@uptrace.dev/<project_id>?protocol=grpc`.
+	Protocol Protocol
+
+	// CAFile, CertFile, and KeyFile are the paths to the PEM files set with the `ca`, `cert`,
+	// and `key` query params, for example,
+	// `https://<token>@uptrace.local/<project_id>?ca=/etc/uptrace/ca.pem`.
+	CAFile   string
+	CertFile string
+	KeyFile  string
 }
 
+// String returns the redacted DSN so the token is not leaked when the DSN is logged
+// or formatted. Use MarshalText to get the DSN including the token.
 func (dsn *DSN) String() string {
-	return dsn.original
+	return dsn.Redacted()
+}
+
+// Redacted returns the DSN with the token replaced by "xxxxx" like url.URL.Redacted.
+func (dsn *DSN) Redacted() string {
+	return redactDSN(dsn.original)
+}
+
+var _ slog.LogValuer = (*DSN)(nil)
+
+// LogValue implements slog.LogValuer and logs the redacted DSN.
+func (dsn *DSN) LogValue() slog.Value {
+	return slog.StringValue(dsn.Redacted())
+}
+
+// MarshalText implements encoding.TextMarshaler and returns the DSN including the token.
+func (dsn *DSN) MarshalText() ([]byte, error) {
+	return []byte(dsn.original), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler using ParseDSN.
+func (dsn *DSN) UnmarshalText(text []byte) error {
+	parsed, err := ParseDSN(string(text))
+	if err != nil {
+		return err
+	}
+	*dsn = *parsed
+	return nil
+}
+
+func redactDSN(dsnStr string) string {
+	u, err := url.Parse(dsnStr)
+	if err != nil {
+		// Hide everything between the scheme and the last '@'.
+		if i := strings.Index(dsnStr, "://"); i >= 0 {
+			if j := strings.LastIndexByte(dsnStr, '@'); j > i {
+				return dsnStr[:i+3] + "xxxxx" + dsnStr[j:]
+			}
+		}
+		return dsnStr
+	}
+	if u.User == nil {
+		return dsnStr
+	}
+	u.User = url.User("xxxxx")
+	return u.String()
 }
 
 func (dsn *DSN) SiteURL() string {
 	if dsn.Host == "uptrace.dev" {
 		return "https://app.uptrace.dev"
 	}
-	return dsn.Scheme + "://" + joinHostPort(dsn.Host, dsn.HTTPPort)
+	return dsn.Scheme + "://" + joinHostPort(dsn.Host, dsn.HTTPPort) + dsn.Path
 }
 
 func (dsn *DSN) OTLPGrpcEndpoint() string {
@@ -34,6 +129,11 @@ func (dsn *DSN) OTLPGrpcEndpoint() string {
 	return joinHostPort(dsn.Host, dsn.GRPCPort)
 }
 
+// OTLPHttpPath returns the OTLP/HTTP path for the signal path, for example, `/v1/traces`.
+func (dsn *DSN) OTLPHttpPath(path string) string {
+	return dsn.Path + path
+}
+
 func (dsn *DSN) OTLPHttpEndpoint() string {
 	if dsn.Host == "uptrace.dev" {
 		return "api.uptrace.dev:443"
@@ -41,24 +141,54 @@ func (dsn *DSN) OTLPHttpEndpoint() string {
 	return joinHostPort(dsn.Host, dsn.HTTPPort)
 }
 
+// Protocol is an OTLP transport protocol.
+type Protocol string
+
+const (
+	// ProtocolHTTP is OTLP/HTTP with protobuf encoding. It is the default protocol.
+	ProtocolHTTP Protocol = "http/protobuf"
+	// ProtocolGRPC is OTLP/gRPC.
+	ProtocolGRPC Protocol = "grpc"
+)
+
+func parseProtocol(s string) (Protocol, error) {
+	switch s {
+	case "http", string(ProtocolHTTP):
+		return ProtocolHTTP, nil
+	case string(ProtocolGRPC):
+		return ProtocolGRPC, nil
+	default:
+		return "", fmt.Errorf("unsupported OTLP protocol: %q", s)
+	}
+}
+
 func ParseDSN(dsnStr string) (*DSN, error) {
 	if dsnStr == "" {
-		return nil, fmt.Errorf("DSN is empty (use WithDSN or UPTRACE_DSN env var)")
+		return nil, fmt.Errorf("%w (use WithDSN or UPTRACE_DSN env var)", ErrEmptyDSN)
 	}
 
 	u, err := url.Parse(dsnStr)
 	if err != nil {
-		return nil, fmt.Errorf("can't parse DSN=%q: %s", dsnStr, err)
+		// url.Error contains the DSN including the token so only the cause is reported.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, &dsnError{
+			dsn:    redactDSN(dsnStr),
+			reason: "can't be parsed: " + err.Error(),
+			err:    ErrInvalidDSN,
+		}
 	}
 
 	if u.Scheme == "" {
-		return nil, fmt.Errorf("DSN=%q does not have a scheme", dsnStr)
+		return nil, &dsnError{dsn: redactDSN(dsnStr), reason: "does not have a scheme", err: ErrNoScheme}
 	}
 	if u.Host == "" {
-		return nil, fmt.Errorf("DSN=%q does not have a host", dsnStr)
+		return nil, &dsnError{dsn: redactDSN(dsnStr), reason: "does not have a host", err: ErrNoHost}
 	}
-	if u.User == nil {
-		return nil, fmt.Errorf("DSN=%q does not have a token", dsnStr)
+	if u.User == nil || u.User.Username() == "" {
+		return nil, &dsnError{dsn: redactDSN(dsnStr), reason: "does not have a token", err: ErrNoToken}
 	}
 
 	dsn := DSN{
@@ -68,6 +198,13 @@ func ParseDSN(dsnStr string) (*DSN, error) {
 		Token:    u.User.Username(),
 	}
 
+	// The last path segment is the project id and the rest is the base path.
+	path := strings.TrimSuffix(u.Path, "/")
+	if i := strings.LastIndexByte(path, '/'); i >= 0 {
+		dsn.ProjectID = path[i+1:]
+		dsn.Path = path[:i]
+	}
+
 	if host, port, err := net.SplitHostPort(u.Host); err == nil {
 		dsn.Host = host
 		dsn.HTTPPort = port
@@ -89,6 +226,20 @@ func ParseDSN(dsnStr string) (*DSN, error) {
 	if grpc := query.Get("grpc"); grpc != "" {
 		dsn.GRPCPort = grpc
 	}
+	if protocol := query.Get("protocol"); protocol != "" {
+		p, err := parseProtocol(protocol)
+		if err != nil {
+			return nil, &dsnError{
+				dsn:    redactDSN(dsnStr),
+				reason: "has " + err.Error(),
+				err:    fmt.Errorf("%w: %w", ErrInvalidDSN, err),
+			}
+		}
+		dsn.Protocol = p
+	}
+	dsn.CAFile = query.Get("ca")
+	dsn.CertFile = query.Get("cert")
+	dsn.KeyFile = query.Get("key")
 
 	if dsn.GRPCPort == "" {
 		if dsn.HTTPPort != "" {
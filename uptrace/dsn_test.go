@@ -1,9 +1,18 @@
 package uptrace_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 
+	"go.opentelemetry.io/otel/log"
+
 	"github.com/uptrace/uptrace-go/uptrace"
 
 	"github.com/stretchr/testify/require"
@@ -71,3 +80,209 @@ func TestParseDSN(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDSNPath(t *testing.T) {
+	type Test struct {
+		dsn        string
+		path       string
+		tracesPath string
+		siteURL    string
+	}
+
+	tests := []Test{
+		{
+			"https://token@uptrace.dev/1",
+			"",
+			"/v1/traces",
+			"https://app.uptrace.dev",
+		},
+		{
+			"http://token@localhost:14318",
+			"",
+			"/v1/traces",
+			"http://localhost:14318",
+		},
+		{
+			"https://token@infra.example.com/uptrace/1",
+			"/uptrace",
+			"/uptrace/v1/traces",
+			"https://infra.example.com:443/uptrace",
+		},
+		{
+			"https://token@infra.example.com/uptrace/1/",
+			"/uptrace",
+			"/uptrace/v1/traces",
+			"https://infra.example.com:443/uptrace",
+		},
+		{
+			"http://token@localhost:8080/apps/uptrace/project_id?grpc=14317",
+			"/apps/uptrace",
+			"/apps/uptrace/v1/traces",
+			"http://localhost:8080/apps/uptrace",
+		},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			dsn, err := uptrace.ParseDSN(test.dsn)
+			require.NoError(t, err)
+			require.Equal(t, test.path, dsn.Path)
+			require.Equal(t, test.tracesPath, dsn.OTLPHttpPath("/v1/traces"))
+			require.Equal(t, test.siteURL, dsn.SiteURL())
+		})
+	}
+}
+
+func TestDSNPathExporters(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	paths := make(map[string]bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		paths[req.URL.Path] = true
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	dsn := "http://token@" + srv.Listener.Addr().String() + "/uptrace/1"
+	client, err := uptrace.New(ctx, uptrace.WithDSN(dsn), uptrace.WithoutGlobals())
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	_, span := client.TracerProvider().Tracer("test").Start(ctx, "hello")
+	span.End()
+
+	counter, err := client.MeterProvider().Meter("test").Int64Counter("test")
+	require.NoError(t, err)
+	counter.Add(ctx, 1)
+
+	var record log.Record
+	record.SetBody(log.StringValue("hello"))
+	client.LoggerProvider().Logger("test").Emit(ctx, record)
+
+	require.NoError(t, client.ForceFlush(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, map[string]bool{
+		"/uptrace/v1/traces":  true,
+		"/uptrace/v1/metrics": true,
+		"/uptrace/v1/logs":    true,
+	}, paths)
+
+	sctx := span.SpanContext()
+	require.Equal(t,
+		fmt.Sprintf("http://%s/uptrace/traces/%s?span_id=%s",
+			srv.Listener.Addr(), sctx.TraceID(), sctx.SpanID()),
+		client.TraceURL(span))
+}
+
+func TestParseDSNProtocol(t *testing.T) {
+	dsn, err := uptrace.ParseDSN("https://token@uptrace.dev/1")
+	require.NoError(t, err)
+	require.Equal(t, uptrace.Protocol(""), dsn.Protocol)
+
+	dsn, err = uptrace.ParseDSN("https://token@uptrace.dev/1?protocol=grpc")
+	require.NoError(t, err)
+	require.Equal(t, uptrace.ProtocolGRPC, dsn.Protocol)
+
+	dsn, err = uptrace.ParseDSN("https://token@uptrace.dev/1?protocol=http")
+	require.NoError(t, err)
+	require.Equal(t, uptrace.ProtocolHTTP, dsn.Protocol)
+
+	_, err = uptrace.ParseDSN("https://token@uptrace.dev/1?protocol=thrift")
+	require.Error(t, err)
+}
+
+func TestParseDSNErrors(t *testing.T) {
+	type Test struct {
+		dsn string
+		err error
+		msg string
+	}
+
+	tests := []Test{
+		{"", uptrace.ErrEmptyDSN, "uptrace: DSN is empty (use WithDSN or UPTRACE_DSN env var)"},
+		{"dsn", uptrace.ErrNoScheme, `DSN="dsn" does not have a scheme`},
+		{"https://token@", uptrace.ErrNoHost, `DSN="https://xxxxx@" does not have a host`},
+		{"https://uptrace.dev/1", uptrace.ErrNoToken, `DSN="https://uptrace.dev/1" does not have a token`},
+		{
+			"https://secret@uptrace.dev:port/1",
+			uptrace.ErrInvalidDSN,
+			`DSN="https://xxxxx@uptrace.dev:port/1" can't be parsed: invalid port ":port" after host`,
+		},
+		{
+			"https://secret@uptrace.dev/1?protocol=foo",
+			uptrace.ErrInvalidDSN,
+			`DSN="https://xxxxx@uptrace.dev/1?protocol=foo" has unsupported OTLP protocol: "foo"`,
+		},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			_, err := uptrace.ParseDSN(test.dsn)
+			require.ErrorIs(t, err, test.err)
+			require.Contains(t, err.Error(), test.msg)
+			require.NotContains(t, err.Error(), "secret")
+		})
+	}
+}
+
+func TestDSNProjectID(t *testing.T) {
+	type Test struct {
+		dsn       string
+		projectID string
+	}
+
+	tests := []Test{
+		{"https://token@uptrace.dev/1", "1"},
+		{"https://token@uptrace.dev/1/", "1"},
+		{"http://token@localhost:14317/project_id", "project_id"},
+		{"https://token@infra.example.com/uptrace/42", "42"},
+		{"http://token@localhost:14318?grpc=14317", ""},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			dsn, err := uptrace.ParseDSN(test.dsn)
+			require.NoError(t, err)
+			require.Equal(t, test.projectID, dsn.ProjectID)
+		})
+	}
+}
+
+func TestDSNRedacted(t *testing.T) {
+	dsn, err := uptrace.ParseDSN("https://secret@uptrace.dev/1?grpc=4317")
+	require.NoError(t, err)
+
+	require.Equal(t, "https://xxxxx@uptrace.dev/1?grpc=4317", dsn.String())
+	require.Equal(t, "https://xxxxx@uptrace.dev/1?grpc=4317", dsn.Redacted())
+	require.Equal(t, "https://xxxxx@uptrace.dev/1?grpc=4317", fmt.Sprint(dsn))
+
+	b, err := dsn.MarshalText()
+	require.NoError(t, err)
+	require.Equal(t, "https://secret@uptrace.dev/1?grpc=4317", string(b))
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	logger.Info("hello", slog.Any("dsn", dsn))
+	require.Contains(t, buf.String(), `dsn="https://xxxxx@uptrace.dev/1?grpc=4317"`)
+	require.NotContains(t, buf.String(), "secret")
+}
+
+func TestDSNText(t *testing.T) {
+	type Config struct {
+		DSN uptrace.DSN `json:"dsn"`
+	}
+
+	var conf Config
+	err := json.Unmarshal([]byte(`{"dsn": "https://token@uptrace.dev/1"}`), &conf)
+	require.NoError(t, err)
+	require.Equal(t, "token", conf.DSN.Token)
+	require.Equal(t, "1", conf.DSN.ProjectID)
+
+	b, err := json.Marshal(&conf)
+	require.NoError(t, err)
+	require.Equal(t, `{"dsn":"https://token@uptrace.dev/1"}`, string(b))
+
+	err = json.Unmarshal([]byte(`{"dsn": "dsn"}`), &conf)
+	require.ErrorIs(t, err, uptrace.ErrNoScheme)
+}
@@ -0,0 +1,137 @@
+package uptrace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/uptrace/uptrace-go/internal"
+)
+
+// dsnFile reads the DSN from a file, for example, a Docker or Kubernetes secret,
+// and reloads it when the file changes so the token can be rotated without a restart.
+// Changes are checked before each export request.
+type dsnFile struct {
+	path string
+
+	dsn atomic.Pointer[DSN]
+
+	mu    sync.Mutex
+	stamp fileStamp
+	// onChange is called after the DSN is reloaded.
+	onChange []func()
+}
+
+func newDSNFile(path string) (*dsnFile, error) {
+	f := &dsnFile{path: path}
+
+	stamp := f.fileStamp()
+	dsn, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	f.stamp = stamp
+	f.dsn.Store(dsn)
+	return f, nil
+}
+
+func (f *dsnFile) fileStamp() fileStamp {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+}
+
+func (f *dsnFile) read() (*DSN, error) {
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read DSN file: %w", err)
+	}
+
+	str := strings.TrimSpace(string(b))
+	if str == "" {
+		return nil, fmt.Errorf("%w (DSN file %q is empty)", ErrEmptyDSN, f.path)
+	}
+
+	dsn, err := ParseDSN(str)
+	if err != nil {
+		return nil, err
+	}
+	if dsn.Token == "<token>" {
+		return nil, fmt.Errorf("%w: %q", ErrDummyDSN, dsn.Redacted())
+	}
+	return dsn, nil
+}
+
+// load returns the current DSN reloading the file if it changed.
+func (f *dsnFile) load() *DSN {
+	f.reload()
+	return f.dsn.Load()
+}
+
+// reload reloads the file if it changed. On errors, for example, when the file
+// is partially written, it keeps using the previous DSN.
+func (f *dsnFile) reload() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stamp := f.fileStamp()
+	if stamp == f.stamp {
+		return
+	}
+
+	dsn, err := f.read()
+	if err != nil {
+		internal.Logger.Printf("can't reload DSN file: %s", err)
+		return
+	}
+	f.stamp = stamp
+
+	prev := f.dsn.Load()
+	if dsn.original == prev.original {
+		return
+	}
+	if !sameDSNEndpoint(dsn, prev) {
+		internal.Logger.Printf("can't reload DSN file: DSN %s has a different endpoint "+
+			"than %s (restart the process to change the endpoint)",
+			dsn.Redacted(), prev.Redacted())
+		return
+	}
+
+	f.dsn.Store(dsn)
+	for _, fn := range f.onChange {
+		fn()
+	}
+}
+
+// subscribe registers fn to be called after the DSN is reloaded.
+func (f *dsnFile) subscribe(fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.onChange = append(f.onChange, fn)
+}
+
+// sameDSNEndpoint reports whether both DSNs export data to the same endpoint
+// so only the uptrace-dsn header needs to change.
+func sameDSNEndpoint(a, b *DSN) bool {
+	return a.Scheme == b.Scheme &&
+		a.Host == b.Host &&
+		a.HTTPPort == b.HTTPPort &&
+		a.GRPCPort == b.GRPCPort &&
+		a.Path == b.Path &&
+		a.Protocol == b.Protocol &&
+		a.CAFile == b.CAFile &&
+		a.CertFile == b.CertFile &&
+		a.KeyFile == b.KeyFile
+}
+
+// headers returns the uptrace-dsn header with the current DSN.
+func (f *dsnFile) headers(ctx context.Context) map[string]string {
+	return map[string]string{"uptrace-dsn": f.load().original}
+}
@@ -0,0 +1,162 @@
+package uptrace_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+
+	"github.com/uptrace/uptrace-go/uptrace"
+)
+
+func TestDSNFile(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var dsns []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.Copy(io.Discard, req.Body)
+
+		dsn := req.Header.Get("uptrace-dsn")
+		mu.Lock()
+		dsns = append(dsns, dsn)
+		mu.Unlock()
+
+		if strings.Contains(dsn, "expired@") {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	dsnFile := filepath.Join(t.TempDir(), "dsn")
+	writeDSNFile(t, dsnFile, "http://expired@"+u.Host+"/1\n")
+
+	t.Setenv("UPTRACE_DSN", "http://env@"+u.Host+"/1")
+	t.Setenv("UPTRACE_DSN_FILE", dsnFile)
+
+	client, err := uptrace.New(ctx,
+		uptrace.WithErrorHandler(func(err error) {}),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	tracer := client.TracerProvider().Tracer("test")
+
+	_, span := tracer.Start(ctx, "hello")
+	span.End()
+	_ = client.ForceFlush(ctx)
+	require.True(t, errors.Is(client.Status(), uptrace.ErrDSNRejected))
+
+	writeDSNFile(t, dsnFile, "http://rotated@"+u.Host+"/1\n")
+
+	_, span = tracer.Start(ctx, "hello")
+	span.End()
+	require.NoError(t, client.ForceFlush(ctx))
+	require.NoError(t, client.Status())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Equal(t, []string{
+		"http://expired@" + u.Host + "/1",
+		"http://rotated@" + u.Host + "/1",
+	}, dsns)
+}
+
+func TestDSNFileGRPC(t *testing.T) {
+	ctx := context.Background()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	traceServer := new(traceServer)
+	srv := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(srv, traceServer)
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	dsn := "http://token1@" + ln.Addr().String() + "/1?protocol=grpc"
+	dsnFile := filepath.Join(t.TempDir(), "dsn")
+	writeDSNFile(t, dsnFile, dsn)
+
+	client, err := uptrace.New(ctx,
+		uptrace.WithDSNFile(dsnFile),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	tracer := client.TracerProvider().Tracer("test")
+	export := func() []string {
+		_, span := tracer.Start(ctx, "hello")
+		span.End()
+		require.NoError(t, client.ForceFlush(ctx))
+
+		traceServer.mu.Lock()
+		defer traceServer.mu.Unlock()
+		return traceServer.md.Get("uptrace-dsn")
+	}
+
+	require.Equal(t, []string{dsn}, export())
+
+	rotated := strings.Replace(dsn, "token1", "token2", 1)
+	writeDSNFile(t, dsnFile, rotated)
+	require.Equal(t, []string{rotated}, export())
+
+	// The endpoint can't be changed without a restart.
+	writeDSNFile(t, dsnFile, "http://token3@uptrace.invalid:4317/1?protocol=grpc")
+	require.Equal(t, []string{rotated}, export())
+}
+
+func TestDSNFileErrors(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	_, err := uptrace.New(ctx, uptrace.WithDSNFile(filepath.Join(dir, "missing")))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	empty := filepath.Join(dir, "empty")
+	writeDSNFile(t, empty, "\n")
+	_, err = uptrace.New(ctx, uptrace.WithDSNFile(empty))
+	require.ErrorIs(t, err, uptrace.ErrEmptyDSN)
+
+	invalid := filepath.Join(dir, "invalid")
+	writeDSNFile(t, invalid, "uptrace.dev/1")
+	_, err = uptrace.New(ctx, uptrace.WithDSNFile(invalid))
+	require.ErrorIs(t, err, uptrace.ErrNoScheme)
+}
+
+// writeDSNFile writes the DSN and bumps the modification time
+// so the change is detected even if the size is the same.
+func writeDSNFile(t *testing.T, path, dsn string) {
+	var modTime time.Time
+	if fi, err := os.Stat(path); err == nil {
+		modTime = fi.ModTime().Add(time.Second)
+	} else {
+		modTime = time.Now()
+	}
+
+	require.NoError(t, os.WriteFile(path, []byte(dsn), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
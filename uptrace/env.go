@@ -0,0 +1,238 @@
+package uptrace
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/uptrace-go/internal"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// applyEnv applies the standard OTEL_* env vars. Invalid values are logged and ignored
+// as required by the OpenTelemetry specification.
+func (conf *config) applyEnv() {
+	if s, ok := os.LookupEnv("OTEL_SDK_DISABLED"); ok {
+		if disabled, err := strconv.ParseBool(s); err == nil {
+			conf.disabled = disabled
+		} else {
+			internal.Logger.Printf("invalid OTEL_SDK_DISABLED=%q: %s", s, err)
+		}
+	}
+
+	if s, ok := os.LookupEnv("OTEL_TRACES_SAMPLER"); ok {
+		if sampler := envSampler(s, os.Getenv("OTEL_TRACES_SAMPLER_ARG")); sampler != nil {
+			conf.traceSampler = sampler
+		}
+	}
+
+	if s, ok := os.LookupEnv("OTEL_PROPAGATORS"); ok {
+		if propagator, err := newTextMapPropagator(strings.Split(s, ",")); err == nil {
+			conf.textMapPropagator = propagator
+		} else {
+			internal.Logger.Printf("invalid OTEL_PROPAGATORS=%q: %s", s, err)
+		}
+	}
+
+	envBatchConfig(&conf.spanBatch, "OTEL_BSP_")
+	envBatchConfig(&conf.logBatch, "OTEL_BLRP_")
+	envDuration(&conf.metricInterval, "OTEL_METRIC_EXPORT_INTERVAL")
+
+	if s, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_PROTOCOL"); ok {
+		if protocol, err := parseProtocol(s); err == nil {
+			conf.protocol = protocol
+		} else {
+			internal.Logger.Printf("invalid OTEL_EXPORTER_OTLP_PROTOCOL=%q: %s", s, err)
+		}
+	}
+	if s, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_HEADERS"); ok {
+		conf.headers = envHeaders(s)
+	}
+	envDuration(&conf.exportTimeout, "OTEL_EXPORTER_OTLP_TIMEOUT")
+	if s, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_CERTIFICATE"); ok {
+		conf.tlsFiles.caFile = s
+	}
+	if s, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE"); ok {
+		conf.tlsFiles.certFile = s
+	}
+	if s, ok := os.LookupEnv("OTEL_EXPORTER_OTLP_CLIENT_KEY"); ok {
+		conf.tlsFiles.keyFile = s
+	}
+
+	if s, ok := os.LookupEnv("UPTRACE_CA_FILE"); ok {
+		conf.tlsFiles.caFile = s
+	}
+	if s, ok := os.LookupEnv("UPTRACE_CERT_FILE"); ok {
+		conf.tlsFiles.certFile = s
+	}
+	if s, ok := os.LookupEnv("UPTRACE_KEY_FILE"); ok {
+		conf.tlsFiles.keyFile = s
+	}
+}
+
+func envSampler(name, arg string) sdktrace.Sampler {
+	ratio := func() float64 {
+		if arg == "" {
+			return 1
+		}
+		ratio, err := strconv.ParseFloat(arg, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			internal.Logger.Printf("invalid OTEL_TRACES_SAMPLER_ARG=%q (using 1.0)", arg)
+			return 1
+		}
+		return ratio
+	}
+
+	switch name {
+	case "always_on":
+		return sdktrace.AlwaysSample()
+	case "always_off":
+		return sdktrace.NeverSample()
+	case "traceidratio":
+		return sdktrace.TraceIDRatioBased(ratio())
+	case "parentbased_always_on":
+		return sdktrace.ParentBased(sdktrace.AlwaysSample())
+	case "parentbased_always_off":
+		return sdktrace.ParentBased(sdktrace.NeverSample())
+	case "parentbased_traceidratio":
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio()))
+	case "uptrace_rules", "parentbased_uptrace_rules":
+		rules, err := parseSamplingRules(arg)
+		if err != nil {
+			internal.Logger.Printf("invalid OTEL_TRACES_SAMPLER_ARG=%q: %s", arg, err)
+			return nil
+		}
+		if name == "uptrace_rules" {
+			return NewRuleBasedSampler(rules...)
+		}
+		return sdktrace.ParentBased(NewRuleBasedSampler(rules...))
+	default:
+		internal.Logger.Printf("unsupported OTEL_TRACES_SAMPLER=%q", name)
+		return nil
+	}
+}
+
+// parseSamplingRules parses sampling rules separated with semicolons. Each rule is
+// a comma-separated list of key=value pairs where the keys `span.name`, `span.kind`,
+// `ratio`, and `rate_limit` are reserved and other keys match span attributes, for example,
+// `http.route=/healthz,ratio=0;http.route=/checkout,ratio=1;ratio=0.05`.
+func parseSamplingRules(s string) ([]SamplingRule, error) {
+	var rules []SamplingRule
+	for _, str := range strings.Split(s, ";") {
+		if strings.TrimSpace(str) == "" {
+			continue
+		}
+
+		rule, err := parseSamplingRule(str)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("no sampling rules")
+	}
+	return rules, nil
+}
+
+func parseSamplingRule(s string) (SamplingRule, error) {
+	var rule SamplingRule
+	var hasAction bool
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return rule, fmt.Errorf("invalid sampling rule: %q", s)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		var err error
+		switch key {
+		case "span.name":
+			rule.SpanName = value
+		case "span.kind":
+			rule.SpanKind, err = parseSpanKind(value)
+		case "ratio":
+			rule.Ratio, err = strconv.ParseFloat(value, 64)
+			if err == nil && (rule.Ratio < 0 || rule.Ratio > 1) {
+				err = fmt.Errorf("ratio must be between 0 and 1, got %g", rule.Ratio)
+			}
+			hasAction = true
+		case "rate_limit":
+			rule.RateLimit, err = strconv.ParseFloat(value, 64)
+			if err == nil && rule.RateLimit <= 0 {
+				err = fmt.Errorf("rate_limit must be positive, got %g", rule.RateLimit)
+			}
+			hasAction = true
+		default:
+			rule.Attributes = append(rule.Attributes, attribute.String(key, value))
+		}
+		if err != nil {
+			return rule, err
+		}
+	}
+	if !hasAction {
+		return rule, fmt.Errorf("sampling rule %q must have ratio or rate_limit", s)
+	}
+	return rule, nil
+}
+
+func envBatchConfig(batch *batchConfig, prefix string) {
+	envDuration(&batch.scheduleDelay, prefix+"SCHEDULE_DELAY")
+	envDuration(&batch.exportTimeout, prefix+"EXPORT_TIMEOUT")
+	envInt(&batch.maxQueueSize, prefix+"MAX_QUEUE_SIZE")
+	envInt(&batch.maxExportBatchSize, prefix+"MAX_EXPORT_BATCH_SIZE")
+}
+
+// envDuration parses a duration in milliseconds.
+func envDuration(dur *time.Duration, key string) {
+	var n int
+	if envInt(&n, key) {
+		*dur = millis(n)
+	}
+}
+
+func envInt(n *int, key string) bool {
+	s, ok := os.LookupEnv(key)
+	if !ok {
+		return false
+	}
+
+	v, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || v <= 0 {
+		internal.Logger.Printf("invalid %s=%q (must be a positive integer)", key, s)
+		return false
+	}
+
+	*n = v
+	return true
+}
+
+// envHeaders parses headers in the `key1=value1,key2=value2` format
+// with URL-encoded values.
+func envHeaders(s string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			internal.Logger.Printf("invalid OTLP header: %q", pair)
+			continue
+		}
+
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			value = unescaped
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return headers
+}
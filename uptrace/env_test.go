@@ -0,0 +1,89 @@
+package uptrace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestEnv(t *testing.T) {
+	t.Setenv("UPTRACE_DSN", "https://token@uptrace.dev/1")
+	t.Setenv("OTEL_TRACES_SAMPLER", "parentbased_traceidratio")
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG", "0.25")
+	t.Setenv("OTEL_PROPAGATORS", "baggage")
+	t.Setenv("OTEL_BSP_SCHEDULE_DELAY", "500")
+	t.Setenv("OTEL_BSP_MAX_QUEUE_SIZE", "100")
+	t.Setenv("OTEL_BLRP_MAX_EXPORT_BATCH_SIZE", "50")
+	t.Setenv("OTEL_BLRP_EXPORT_TIMEOUT", "invalid")
+	t.Setenv("OTEL_METRIC_EXPORT_INTERVAL", "60000")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=secret,x-name=hello%20world")
+	t.Setenv("OTEL_EXPORTER_OTLP_TIMEOUT", "3000")
+
+	conf, err := newConfig(nil)
+	require.NoError(t, err)
+
+	require.False(t, conf.disabled)
+	require.Contains(t, conf.traceSampler.Description(), "root:TraceIDRatioBased{0.25}")
+	require.Equal(t, []string{"baggage"}, conf.textMapPropagator.Fields())
+	require.Equal(t, 500*time.Millisecond, conf.spanBatch.scheduleDelay)
+	require.Equal(t, 100, conf.spanBatch.maxQueueSize)
+	require.Equal(t, 50, conf.logBatch.maxExportBatchSize)
+	require.Equal(t, 10*time.Second, conf.logBatch.exportTimeout)
+	require.Equal(t, time.Minute, conf.metricInterval)
+	require.Equal(t, 3*time.Second, conf.exportTimeout)
+
+	dsn, err := ParseDSN("https://token@uptrace.dev/1")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"api-key":     "secret",
+		"x-name":      "hello world",
+		"uptrace-dsn": "https://token@uptrace.dev/1",
+	}, conf.otlpHeaders(dsn))
+
+	// Options take precedence over env vars.
+	conf, err = newConfig([]Option{WithTraceSampler(sdktrace.AlwaysSample())})
+	require.NoError(t, err)
+	require.Equal(t, "AlwaysOnSampler", conf.traceSampler.Description())
+}
+
+func TestEnvRuleBasedSampler(t *testing.T) {
+	t.Setenv("OTEL_TRACES_SAMPLER", "parentbased_uptrace_rules")
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG",
+		"http.route=/healthz,ratio=0; span.kind=server,span.name=poll,rate_limit=10; ratio=0.05")
+
+	conf, err := newConfig(nil)
+	require.NoError(t, err)
+	require.Contains(t, conf.traceSampler.Description(),
+		"root:RuleBasedSampler{TraceIDRatioBased{0},RateLimitingSampler{10},TraceIDRatioBased{0.05}}")
+
+	rules, err := parseSamplingRules("http.route=/healthz,ratio=0;span.kind=server,rate_limit=10")
+	require.NoError(t, err)
+	require.Equal(t, []SamplingRule{
+		{Attributes: []attribute.KeyValue{attribute.String("http.route", "/healthz")}},
+		{SpanKind: trace.SpanKindServer, RateLimit: 10},
+	}, rules)
+
+	for _, s := range []string{
+		"",
+		"http.route=/healthz",
+		"ratio=2",
+		"rate_limit=0",
+		"span.kind=unknown,ratio=1",
+		"ratio",
+	} {
+		_, err := parseSamplingRules(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestEnvSDKDisabled(t *testing.T) {
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+
+	conf, err := newConfig(nil)
+	require.NoError(t, err)
+	require.True(t, conf.disabled)
+}
@@ -0,0 +1,101 @@
+package uptrace
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// ExportOTLP exports an OTLP export request encoded with protobuf, for example,
+// a serialized ExportTraceServiceRequest, to the configured DSNs. The request is sent
+// with the same HTTP client or gRPC connection as the exporters so it is split, spilled
+// to the disk queue, and sent to the active DSN in the DSNFailover mode.
+//
+// It can be used to upload data that was not produced by the SDK, for example,
+// the files written by WithFileExporter. Unlike the exporters, ExportOTLP does not
+// retry failed requests.
+func (c *Client) ExportOTLP(ctx context.Context, signal Signal, body []byte) error {
+	switch signal {
+	case SignalTraces, SignalMetrics, SignalLogs:
+	default:
+		return fmt.Errorf("uptrace: unsupported signal: %q", signal)
+	}
+	if len(c.transports) == 0 {
+		return errors.New("uptrace: DSN is not configured")
+	}
+
+	if c.failover != nil {
+		return c.failover.do(ctx, func(ctx context.Context, i int) error {
+			return c.transports[i].exportOTLP(ctx, signal, body)
+		})
+	}
+
+	var errs []error
+	for _, t := range c.transports {
+		if err := t.exportOTLP(ctx, signal, body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *transport) exportOTLP(ctx context.Context, signal Signal, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	if t.grpcConn != nil {
+		method := grpcExportMethod(signal)
+		req, resp, _ := newGRPCExportMessages(method)
+		if err := proto.Unmarshal(body, req); err != nil {
+			return err
+		}
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(t.headers))
+		return t.grpcConn.Invoke(ctx, method, req, resp)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(body)
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	// The signal names match the OTLP/HTTP paths, for example, `/v1/traces`.
+	url := t.dsn.Scheme + "://" + t.dsn.OTLPHttpEndpoint() +
+		t.dsn.OTLPHttpPath("/v1/"+string(signal))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &buf)
+	if err != nil {
+		return err
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	const maxMessageSize = 1 << 10
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	if s := strings.TrimSpace(string(msg)); s != "" {
+		return fmt.Errorf("%s responded with %s: %s", url, resp.Status, s)
+	}
+	return fmt.Errorf("%s responded with %s", url, resp.Status)
+}
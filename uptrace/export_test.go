@@ -0,0 +1,143 @@
+package uptrace_test
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/uptrace/uptrace-go/uptrace"
+)
+
+func newTestTraceRequest(spanNames ...string) *collectortrace.ExportTraceServiceRequest {
+	spans := make([]*tracepb.Span, len(spanNames))
+	for i, name := range spanNames {
+		spans[i] = &tracepb.Span{
+			TraceId: []byte("0123456789abcdef"),
+			SpanId:  []byte("01234567"),
+			Name:    name,
+		}
+	}
+	return &collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: spans}},
+		}},
+	}
+}
+
+func TestExportOTLP(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var paths []string
+	var received []*collectortrace.ExportTraceServiceRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "gzip", req.Header.Get("Content-Encoding"))
+		require.Equal(t, "http://token@"+req.Host+"/1", req.Header.Get("uptrace-dsn"))
+
+		zr, err := gzip.NewReader(req.Body)
+		require.NoError(t, err)
+		b, err := io.ReadAll(zr)
+		require.NoError(t, err)
+
+		msg := new(collectortrace.ExportTraceServiceRequest)
+		require.NoError(t, proto.Unmarshal(b, msg))
+
+		mu.Lock()
+		paths = append(paths, req.URL.Path)
+		received = append(received, msg)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	client, err := uptrace.New(ctx,
+		uptrace.WithDSN("http://token@"+srv.Listener.Addr().String()+"/1"),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	body, err := proto.Marshal(newTestTraceRequest("span1", "span2"))
+	require.NoError(t, err)
+	require.NoError(t, client.ExportOTLP(ctx, uptrace.SignalTraces, body))
+
+	err = client.ExportOTLP(ctx, uptrace.Signal("profiles"), body)
+	require.Error(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Equal(t, []string{"/v1/traces"}, paths)
+	require.Len(t, received, 1)
+	require.True(t, proto.Equal(newTestTraceRequest("span1", "span2"), received[0]))
+}
+
+func TestExportOTLPError(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	client, err := uptrace.New(ctx,
+		uptrace.WithDSN("http://token@"+srv.Listener.Addr().String()+"/1"),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	body, err := proto.Marshal(newTestTraceRequest("span1"))
+	require.NoError(t, err)
+
+	err = client.ExportOTLP(ctx, uptrace.SignalTraces, body)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "400 Bad Request: bad request")
+}
+
+func TestExportOTLPGRPC(t *testing.T) {
+	ctx := context.Background()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	traceServer := new(traceServer)
+	srv := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(srv, traceServer)
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	client, err := uptrace.New(ctx,
+		uptrace.WithDSN("http://token@"+ln.Addr().String()+"/1?protocol=grpc"),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	body, err := proto.Marshal(newTestTraceRequest("span1", "span2", "span3"))
+	require.NoError(t, err)
+	require.NoError(t, client.ExportOTLP(ctx, uptrace.SignalTraces, body))
+
+	traceServer.mu.Lock()
+	defer traceServer.mu.Unlock()
+
+	require.Equal(t, 3, traceServer.spans)
+	require.Equal(t, []string{"http://token@" + ln.Addr().String() + "/1?protocol=grpc"},
+		traceServer.md.Get("uptrace-dsn"))
+}
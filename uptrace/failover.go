@@ -0,0 +1,301 @@
+package uptrace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uptrace/uptrace-go/internal"
+
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// DSNMode specifies how data is exported when multiple DSNs are configured.
+type DSNMode string
+
+const (
+	// DSNFanout exports all data to every DSN. It is the default mode.
+	DSNFanout DSNMode = "fanout"
+	// DSNFailover treats the DSNs as a priority list and exports data to the first
+	// healthy DSN only.
+	DSNFailover DSNMode = "failover"
+)
+
+func parseDSNMode(s string) (DSNMode, error) {
+	switch DSNMode(s) {
+	case DSNFanout, DSNFailover:
+		return DSNMode(s), nil
+	default:
+		return "", fmt.Errorf("unsupported DSN mode: %q", s)
+	}
+}
+
+const (
+	failoverThreshold     = 3
+	failoverProbeInterval = 30 * time.Second
+	failoverProbeTimeout  = 5 * time.Second
+)
+
+// failover selects the DSN used by the exporters in the DSNFailover mode.
+// The state is shared by all signals so they switch DSNs together.
+type failover struct {
+	transports    []*transport
+	threshold     int
+	probeInterval time.Duration
+
+	mu        sync.Mutex
+	active    int
+	failures  int
+	lastProbe time.Time
+}
+
+func newFailover(conf *config) *failover {
+	return &failover{
+		transports:    conf.transports,
+		threshold:     failoverThreshold,
+		probeInterval: conf.failoverProbeInterval,
+	}
+}
+
+// do calls fn with the index of the active DSN. After the threshold of consecutive
+// failures is reached, it switches to the next DSN and retries fn with it.
+func (f *failover) do(ctx context.Context, fn func(ctx context.Context, i int) error) error {
+	f.failBack(ctx)
+
+	f.mu.Lock()
+	start := f.active
+	f.mu.Unlock()
+
+	var err error
+	for i := start; i < len(f.transports); i++ {
+		if err = fn(ctx, i); err == nil {
+			f.success(i)
+			return nil
+		}
+		if !f.failure(i) {
+			return err
+		}
+	}
+	return err
+}
+
+func (f *failover) success(i int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if i == f.active {
+		f.failures = 0
+	}
+}
+
+// failure records a failed export to the DSN i and reports whether the export
+// should be retried with the next DSN.
+func (f *failover) failure(i int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if i < f.active {
+		// Another export already switched to the next DSN.
+		return true
+	}
+	if i > f.active {
+		return false
+	}
+
+	f.failures++
+	if f.failures < f.threshold || f.active+1 >= len(f.transports) {
+		return false
+	}
+
+	f.active++
+	f.failures = 0
+	f.lastProbe = time.Now()
+	internal.Logger.Printf("switching to DSN %s after %d failed exports",
+		f.transports[f.active].dsn.SiteURL(), f.threshold)
+	return true
+}
+
+// failBack probes the DSNs with a higher priority than the active DSN and
+// switches to the first healthy DSN. Probes are sent at most once per probe interval.
+func (f *failover) failBack(ctx context.Context) {
+	f.mu.Lock()
+	active := f.active
+	if active == 0 || time.Since(f.lastProbe) < f.probeInterval {
+		f.mu.Unlock()
+		return
+	}
+	f.lastProbe = time.Now()
+	f.mu.Unlock()
+
+	for i := 0; i < active; i++ {
+		t := f.transports[i]
+		if err := t.probe(ctx); err != nil {
+			continue
+		}
+
+		f.mu.Lock()
+		if i < f.active {
+			f.active = i
+			f.failures = 0
+			internal.Logger.Printf("switching back to DSN %s", t.dsn.SiteURL())
+		}
+		f.mu.Unlock()
+		return
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// probe checks that the DSN accepts data by sending an empty OTLP trace request.
+// The request bypasses the disk queue.
+func (t *transport) probe(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, failoverProbeTimeout)
+	defer cancel()
+
+	if t.grpcConn != nil {
+		ctx = context.WithValue(ctx, diskQueueReplayKey{}, true)
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(t.headers))
+		return t.grpcConn.Invoke(ctx, grpcTracesMethod,
+			new(collectortrace.ExportTraceServiceRequest),
+			new(collectortrace.ExportTraceServiceResponse))
+	}
+
+	url := t.dsn.Scheme + "://" + t.dsn.OTLPHttpEndpoint() + t.dsn.OTLPHttpPath("/v1/traces")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(nil))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.probeTransport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	return fmt.Errorf("%s responded with %s", url, resp.Status)
+}
+
+//------------------------------------------------------------------------------
+
+// failoverSpanExporter exports spans to the active DSN.
+type failoverSpanExporter struct {
+	failover  *failover
+	exporters []sdktrace.SpanExporter
+	queue     *exportStats
+}
+
+var _ sdktrace.SpanExporter = (*failoverSpanExporter)(nil)
+
+func (e *failoverSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.queue.dequeue(int64(len(spans)))
+	return e.failover.do(ctx, func(ctx context.Context, i int) error {
+		return e.exporters[i].ExportSpans(ctx, spans)
+	})
+}
+
+func (e *failoverSpanExporter) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, exp := range e.exporters {
+		if err := exp.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// failoverMetricExporter exports metrics to the active DSN.
+type failoverMetricExporter struct {
+	sdkmetric.Exporter // the first exporter provides temporality and aggregation
+	failover           *failover
+	exporters          []sdkmetric.Exporter
+}
+
+var _ sdkmetric.Exporter = (*failoverMetricExporter)(nil)
+
+func newFailoverMetricExporter(f *failover, exporters []sdkmetric.Exporter) *failoverMetricExporter {
+	return &failoverMetricExporter{
+		Exporter:  exporters[0],
+		failover:  f,
+		exporters: exporters,
+	}
+}
+
+func (e *failoverMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	return e.failover.do(ctx, func(ctx context.Context, i int) error {
+		return e.exporters[i].Export(ctx, rm)
+	})
+}
+
+func (e *failoverMetricExporter) ForceFlush(ctx context.Context) error {
+	var errs []error
+	for _, exp := range e.exporters {
+		if err := exp.ForceFlush(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *failoverMetricExporter) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, exp := range e.exporters {
+		if err := exp.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// failoverLogExporter exports log records to the active DSN.
+type failoverLogExporter struct {
+	failover  *failover
+	exporters []sdklog.Exporter
+	queue     *exportStats
+}
+
+var _ sdklog.Exporter = (*failoverLogExporter)(nil)
+
+func (e *failoverLogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	e.queue.dequeue(int64(len(records)))
+	return e.failover.do(ctx, func(ctx context.Context, i int) error {
+		return e.exporters[i].Export(ctx, records)
+	})
+}
+
+func (e *failoverLogExporter) ForceFlush(ctx context.Context) error {
+	var errs []error
+	for _, exp := range e.exporters {
+		if err := exp.ForceFlush(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *failoverLogExporter) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, exp := range e.exporters {
+		if err := exp.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
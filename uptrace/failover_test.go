@@ -0,0 +1,91 @@
+package uptrace
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type failoverServer struct {
+	*httptest.Server
+	down     atomic.Bool
+	requests atomic.Int64
+	probes   atomic.Int64
+}
+
+func newFailoverServer() *failoverServer {
+	srv := new(failoverServer)
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		if len(body) == 0 {
+			srv.probes.Add(1)
+		} else {
+			srv.requests.Add(1)
+		}
+		if srv.down.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return srv
+}
+
+func (srv *failoverServer) dsn() string {
+	return "http://token@" + srv.Listener.Addr().String() + "/1"
+}
+
+func TestFailover(t *testing.T) {
+	ctx := context.Background()
+
+	primary := newFailoverServer()
+	defer primary.Close()
+	standby := newFailoverServer()
+	defer standby.Close()
+
+	client, err := New(ctx,
+		WithDSN(primary.dsn(), standby.dsn()),
+		WithDSNMode(DSNFailover),
+		WithMetricsDisabled(),
+		WithLoggingDisabled(),
+		WithoutGlobals(),
+		WithDSNFailoverProbeInterval(time.Nanosecond),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	export := func() error {
+		_, span := client.TracerProvider().Tracer("test").Start(ctx, "hello")
+		span.End()
+		return client.ForceFlush(ctx)
+	}
+
+	require.NoError(t, export())
+	require.Equal(t, int64(1), primary.requests.Load())
+	require.Equal(t, int64(0), standby.requests.Load())
+
+	primary.down.Store(true)
+	require.Error(t, export())
+	require.Error(t, export())
+	require.NoError(t, export())
+	require.Equal(t, int64(4), primary.requests.Load())
+	require.Equal(t, int64(1), standby.requests.Load())
+
+	// The primary is still down so the probe fails.
+	require.NoError(t, export())
+	require.Equal(t, int64(1), primary.probes.Load())
+	require.Equal(t, int64(4), primary.requests.Load())
+	require.Equal(t, int64(2), standby.requests.Load())
+
+	primary.down.Store(false)
+	require.NoError(t, export())
+	require.Equal(t, int64(2), primary.probes.Load())
+	require.Equal(t, int64(5), primary.requests.Load())
+	require.Equal(t, int64(2), standby.requests.Load())
+}
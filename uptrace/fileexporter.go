@@ -0,0 +1,436 @@
+package uptrace
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptrace/uptrace-go/internal"
+	"github.com/uptrace/uptrace-go/internal/otlpjson"
+	"github.com/uptrace/uptrace-go/internal/otlpproto"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultFileMaxBytes       = 100 << 20
+	defaultFileRotateInterval = time.Hour
+
+	fileTimeFormat = "20060102T150405.000Z"
+)
+
+type fileExporterConfig struct {
+	dir            string
+	maxBytes       int64
+	rotateInterval time.Duration
+	maxFiles       int
+	maxAge         time.Duration
+}
+
+func newFileExporterConfig(dir string, opts []FileExporterOption) *fileExporterConfig {
+	conf := &fileExporterConfig{
+		dir:            dir,
+		maxBytes:       defaultFileMaxBytes,
+		rotateInterval: defaultFileRotateInterval,
+	}
+	for _, opt := range opts {
+		opt(conf)
+	}
+	return conf
+}
+
+// FileExporterOption configures the file exporter created with WithFileExporter.
+type FileExporterOption func(conf *fileExporterConfig)
+
+// WithFileMaxBytes rotates a file when it reaches the size. The default is 100MiB.
+func WithFileMaxBytes(n int64) FileExporterOption {
+	return func(conf *fileExporterConfig) {
+		conf.maxBytes = n
+	}
+}
+
+// WithFileRotateInterval rotates a file after it has been written for the duration.
+// The default is 1 hour.
+func WithFileRotateInterval(d time.Duration) FileExporterOption {
+	return func(conf *fileExporterConfig) {
+		conf.rotateInterval = d
+	}
+}
+
+// WithFileMaxFiles limits the number of rotated files kept for each signal.
+// The oldest files are removed first. The default is to keep all files.
+func WithFileMaxFiles(n int) FileExporterOption {
+	return func(conf *fileExporterConfig) {
+		conf.maxFiles = n
+	}
+}
+
+// WithFileMaxAge removes rotated files older than the duration.
+// The default is to keep all files.
+func WithFileMaxAge(d time.Duration) FileExporterOption {
+	return func(conf *fileExporterConfig) {
+		conf.maxAge = d
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// fileExporter writes OTLP requests as OTLP/JSON lines into files rotated by size
+// and time. It is used as the HTTP transport of OTLP/HTTP exporters so the data is
+// encoded by the standard exporters.
+type fileExporter struct {
+	conf  *fileExporterConfig
+	url   string
+	files map[Signal]*rotatingFile
+	stats []*exportStats
+}
+
+var _ http.RoundTripper = (*fileExporter)(nil)
+
+func newFileExporter(conf *fileExporterConfig) (*fileExporter, error) {
+	dir, err := filepath.Abs(conf.dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("can't create file exporter dir: %w", err)
+	}
+
+	e := &fileExporter{
+		conf:  conf,
+		url:   "file://" + filepath.ToSlash(dir),
+		files: make(map[Signal]*rotatingFile),
+	}
+	for _, signal := range []Signal{SignalTraces, SignalMetrics, SignalLogs} {
+		e.files[signal] = &rotatingFile{
+			conf: conf,
+			dir:  dir,
+			name: string(signal),
+		}
+	}
+	return e, nil
+}
+
+func (e *fileExporter) httpClient() *http.Client {
+	return &http.Client{Transport: &statsTransport{next: e}}
+}
+
+// signalStats returns the export stats for the signal.
+func (e *fileExporter) signalStats(signal Signal) *exportStats {
+	for _, s := range e.stats {
+		if s.signal == signal {
+			return s
+		}
+	}
+	s := newExportStats(e.url, signal)
+	e.stats = append(e.stats, s)
+	return s
+}
+
+func (e *fileExporter) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	signal, ok := signalFromPath(req.URL.Path)
+	if !ok {
+		return nil, fmt.Errorf("unknown OTLP/HTTP path: %q", req.URL.Path)
+	}
+
+	msg := otlpproto.NewExportRequest(string(signal))
+	if err := proto.Unmarshal(body, msg); err != nil {
+		return nil, err
+	}
+	line, err := otlpjson.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.files[signal].write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": {"application/x-protobuf"}},
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+// Close closes the files and waits for the rotated files to be compressed.
+// It must be called after the exporters are shut down.
+func (e *fileExporter) Close() error {
+	var lastErr error
+	for _, f := range e.files {
+		if err := f.Close(); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (e *fileExporter) spanExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	return otlptrace.New(ctx, otlptracehttp.NewClient(
+		otlptracehttp.WithEndpoint("localhost"),
+		otlptracehttp.WithInsecure(),
+		otlptracehttp.WithHTTPClient(e.httpClient()),
+		otlptracehttp.WithRetry(otlptracehttp.RetryConfig{Enabled: false}),
+	))
+}
+
+func (e *fileExporter) metricExporter(ctx context.Context) (sdkmetric.Exporter, error) {
+	return otlpmetrichttp.New(ctx,
+		otlpmetrichttp.WithEndpoint("localhost"),
+		otlpmetrichttp.WithInsecure(),
+		otlpmetrichttp.WithHTTPClient(e.httpClient()),
+		otlpmetrichttp.WithRetry(otlpmetrichttp.RetryConfig{Enabled: false}),
+		otlpmetrichttp.WithTemporalitySelector(preferDeltaTemporalitySelector),
+	)
+}
+
+func (e *fileExporter) logExporter(ctx context.Context) (sdklog.Exporter, error) {
+	return otlploghttp.New(ctx,
+		otlploghttp.WithEndpoint("localhost"),
+		otlploghttp.WithInsecure(),
+		otlploghttp.WithHTTPClient(e.httpClient()),
+		otlploghttp.WithRetry(otlploghttp.RetryConfig{Enabled: false}),
+	)
+}
+
+//------------------------------------------------------------------------------
+
+// rotatingFile appends lines to the `<name>.jsonl` file. On rotation, the file is
+// renamed to `<name>-<time>.jsonl` and compressed to `<name>-<time>.jsonl.gz`
+// in the background, and the rotated files exceeding the retention limits are removed.
+type rotatingFile struct {
+	conf *fileExporterConfig
+	dir  string
+	name string
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	wg sync.WaitGroup
+}
+
+func (f *rotatingFile) path() string {
+	return filepath.Join(f.dir, f.name+".jsonl")
+}
+
+func (f *rotatingFile) write(line []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file != nil && f.size > 0 && f.shouldRotate(int64(len(line))) {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	return err
+}
+
+func (f *rotatingFile) shouldRotate(n int64) bool {
+	if f.conf.maxBytes > 0 && f.size+n > f.conf.maxBytes {
+		return true
+	}
+	if f.conf.rotateInterval > 0 && time.Since(f.openedAt) >= f.conf.rotateInterval {
+		return true
+	}
+	return false
+}
+
+// open opens the file for appending. Rotated files left uncompressed,
+// for example, after a crash, are compressed and the old rotated files are removed
+// when the file is opened for the first time.
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if f.openedAt.IsZero() {
+		paths, _ := filepath.Glob(filepath.Join(f.dir, f.name+"-*.jsonl"))
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			for _, path := range paths {
+				f.compress(path)
+			}
+			f.removeOld()
+		}()
+	}
+
+	f.file = file
+	f.size = fi.Size()
+	f.openedAt = time.Now()
+	return nil
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	rotated := f.rotatedPath(time.Now())
+	if err := os.Rename(f.path(), rotated); err != nil {
+		return err
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.compress(rotated)
+		f.removeOld()
+	}()
+	return nil
+}
+
+// rotatedPath returns a unique path for the rotated file.
+func (f *rotatingFile) rotatedPath(tm time.Time) string {
+	for {
+		path := filepath.Join(f.dir, f.name+"-"+tm.UTC().Format(fileTimeFormat)+".jsonl")
+		if !fileExists(path) && !fileExists(path+".gz") {
+			return path
+		}
+		tm = tm.Add(time.Millisecond)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (f *rotatingFile) compress(path string) {
+	if err := gzipFile(path); err != nil {
+		internal.Logger.Printf("can't compress %s: %s", path, err)
+	}
+}
+
+// gzipFile compresses the file to `<path>.gz` and removes the file.
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+	if _, err := io.Copy(zw, src); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// removeOld removes the rotated files exceeding the max number of files or the max age.
+func (f *rotatingFile) removeOld() {
+	if f.conf.maxFiles <= 0 && f.conf.maxAge <= 0 {
+		return
+	}
+
+	paths, err := filepath.Glob(filepath.Join(f.dir, f.name+"-*.jsonl.gz"))
+	if err != nil {
+		return
+	}
+	// The time in the file names sorts lexically.
+	slices.Sort(paths)
+
+	for i, path := range paths {
+		if f.conf.maxFiles > 0 && len(paths)-i > f.conf.maxFiles {
+			f.remove(path)
+			continue
+		}
+		if f.conf.maxAge > 0 && f.rotatedAt(path).Before(time.Now().Add(-f.conf.maxAge)) {
+			f.remove(path)
+		}
+	}
+}
+
+func (f *rotatingFile) rotatedAt(path string) time.Time {
+	s := strings.TrimPrefix(filepath.Base(path), f.name+"-")
+	s = strings.TrimSuffix(s, ".jsonl.gz")
+	tm, err := time.Parse(fileTimeFormat, s)
+	if err != nil {
+		return time.Now()
+	}
+	return tm
+}
+
+func (f *rotatingFile) remove(path string) {
+	// The file may be already removed by another rotation.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		internal.Logger.Printf("can't remove %s: %s", path, err)
+	}
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+
+	f.wg.Wait()
+	return err
+}
@@ -0,0 +1,168 @@
+package uptrace_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/log"
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/uptrace/uptrace-go/internal/otlpjson"
+	"github.com/uptrace/uptrace-go/uptrace"
+)
+
+func TestFileExporter(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	client, err := uptrace.New(ctx,
+		uptrace.WithFileExporter(dir),
+		uptrace.WithoutGlobals(),
+	)
+	require.NoError(t, err)
+
+	_, span := client.TracerProvider().Tracer("test").Start(ctx, "hello")
+	span.End()
+
+	counter, err := client.MeterProvider().Meter("test").Int64Counter("test.counter")
+	require.NoError(t, err)
+	counter.Add(ctx, 1)
+
+	var record log.Record
+	record.SetBody(log.StringValue("hello log"))
+	client.LoggerProvider().Logger("test").Emit(ctx, record)
+
+	require.NoError(t, client.ForceFlush(ctx))
+
+	stats := client.Stats()
+	require.NotEmpty(t, stats)
+	for _, s := range stats {
+		require.Equal(t, "file://"+filepath.ToSlash(dir), s.DSN)
+	}
+
+	require.NoError(t, client.Shutdown(ctx))
+
+	traces := readJSONLines(t, filepath.Join(dir, "traces.jsonl"),
+		func() proto.Message { return new(collectortrace.ExportTraceServiceRequest) })
+	require.Len(t, traces, 1)
+	req := traces[0].(*collectortrace.ExportTraceServiceRequest)
+	otlpSpan := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	require.Equal(t, "hello", otlpSpan.Name)
+	require.Equal(t, span.SpanContext().TraceID().String(), hex.EncodeToString(otlpSpan.TraceId))
+
+	b, err := os.ReadFile(filepath.Join(dir, "traces.jsonl"))
+	require.NoError(t, err)
+	require.Contains(t, string(b), `"traceId":"`+span.SpanContext().TraceID().String()+`"`)
+
+	metrics := readJSONLines(t, filepath.Join(dir, "metrics.jsonl"),
+		func() proto.Message { return new(collectormetrics.ExportMetricsServiceRequest) })
+	require.NotEmpty(t, metrics)
+
+	logs := readJSONLines(t, filepath.Join(dir, "logs.jsonl"),
+		func() proto.Message { return new(collectorlogs.ExportLogsServiceRequest) })
+	require.Len(t, logs, 1)
+	logRecord := logs[0].(*collectorlogs.ExportLogsServiceRequest).
+		ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	require.Equal(t, "hello log", logRecord.Body.GetStringValue())
+}
+
+func TestFileExporterRotation(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	client, err := uptrace.New(ctx,
+		uptrace.WithFileExporter(dir,
+			uptrace.WithFileMaxBytes(1),
+			uptrace.WithFileMaxFiles(2),
+		),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+	)
+	require.NoError(t, err)
+
+	tracer := client.TracerProvider().Tracer("test")
+	for i := 0; i < 4; i++ {
+		_, span := tracer.Start(ctx, "hello")
+		span.End()
+		require.NoError(t, client.ForceFlush(ctx))
+	}
+	require.NoError(t, client.Shutdown(ctx))
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "traces-*"))
+	require.NoError(t, err)
+	require.Len(t, rotated, 2)
+
+	for _, path := range rotated {
+		require.Equal(t, ".gz", filepath.Ext(path))
+		traces := readJSONLines(t, path,
+			func() proto.Message { return new(collectortrace.ExportTraceServiceRequest) })
+		require.Len(t, traces, 1)
+	}
+
+	traces := readJSONLines(t, filepath.Join(dir, "traces.jsonl"),
+		func() proto.Message { return new(collectortrace.ExportTraceServiceRequest) })
+	require.Len(t, traces, 1)
+}
+
+func TestFileExporterRemoveOldOnOpen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// Rotated files left uncompressed by a previous process.
+	for _, tm := range []string{"20200101T000000.000Z", "20200102T000000.000Z", "20200103T000000.000Z"} {
+		path := filepath.Join(dir, "traces-"+tm+".jsonl")
+		require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0o644))
+	}
+
+	client, err := uptrace.New(ctx,
+		uptrace.WithFileExporter(dir, uptrace.WithFileMaxFiles(2)),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+	)
+	require.NoError(t, err)
+
+	_, span := client.TracerProvider().Tracer("test").Start(ctx, "hello")
+	span.End()
+	require.NoError(t, client.Shutdown(ctx))
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "traces-*"))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "traces-20200102T000000.000Z.jsonl.gz"),
+		filepath.Join(dir, "traces-20200103T000000.000Z.jsonl.gz"),
+	}, rotated)
+}
+
+func readJSONLines(t *testing.T, path string, newMsg func() proto.Message) []proto.Message {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if filepath.Ext(path) == ".gz" {
+		zr, err := gzip.NewReader(f)
+		require.NoError(t, err)
+		scanner = bufio.NewScanner(zr)
+	}
+	scanner.Buffer(nil, 1<<20)
+
+	var msgs []proto.Message
+	for scanner.Scan() {
+		msg := newMsg()
+		require.NoError(t, otlpjson.Unmarshal(scanner.Bytes(), msg))
+		msgs = append(msgs, msg)
+	}
+	require.NoError(t, scanner.Err())
+	return msgs
+}
@@ -0,0 +1,116 @@
+package uptrace_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/uptrace/uptrace-go/uptrace"
+)
+
+func TestGRPCProtocol(t *testing.T) {
+	ctx := context.Background()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	traceServer := new(traceServer)
+	srv := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(srv, traceServer)
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	dsn := "http://token@" + ln.Addr().String() + "/1?protocol=grpc"
+	client, err := uptrace.New(ctx,
+		uptrace.WithDSN(dsn),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	_, span := client.TracerProvider().Tracer("test").Start(ctx, "hello")
+	span.End()
+	require.NoError(t, client.ForceFlush(ctx))
+
+	traceServer.mu.Lock()
+	defer traceServer.mu.Unlock()
+
+	require.Equal(t, 1, traceServer.spans)
+	require.Equal(t, []string{dsn}, traceServer.md.Get("uptrace-dsn"))
+}
+
+type traceServer struct {
+	collectortrace.UnimplementedTraceServiceServer
+
+	mu       sync.Mutex
+	spans    int
+	requests int
+	md       metadata.MD
+	err      error
+}
+
+func (s *traceServer) Export(
+	ctx context.Context, req *collectortrace.ExportTraceServiceRequest,
+) (*collectortrace.ExportTraceServiceResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	s.md, _ = metadata.FromIncomingContext(ctx)
+	if s.err != nil {
+		return nil, s.err
+	}
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			s.spans += len(ss.Spans)
+		}
+	}
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+func TestGRPCUnknownToken(t *testing.T) {
+	ctx := context.Background()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	traceServer := &traceServer{err: status.Error(codes.Unauthenticated, "invalid token")}
+	srv := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(srv, traceServer)
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	client, err := uptrace.New(ctx,
+		uptrace.WithDSN("http://token@"+ln.Addr().String()+"/1?protocol=grpc"),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+		uptrace.WithErrorHandler(func(err error) {}),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	for i := 0; i < 2; i++ {
+		_, span := client.TracerProvider().Tracer("test").Start(ctx, "hello")
+		span.End()
+		require.Error(t, client.ForceFlush(ctx))
+	}
+
+	err = client.Status()
+	require.ErrorIs(t, err, uptrace.ErrDSNRejected)
+	require.Contains(t, err.Error(), "invalid token")
+
+	traceServer.mu.Lock()
+	defer traceServer.mu.Unlock()
+	require.Equal(t, 1, traceServer.requests)
+}
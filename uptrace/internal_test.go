@@ -2,11 +2,14 @@ package uptrace
 
 import (
 	"context"
+	"encoding/binary"
 	"math"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestIDGenerator(t *testing.T) {
@@ -22,7 +25,175 @@ func TestIDGenerator(t *testing.T) {
 	require.NotEqual(t, spanID1, spanID3)
 }
 
+func TestIDGeneratorLayout(t *testing.T) {
+	ctx := context.Background()
+	gen := newIDGenerator()
+
+	before := time.Now().UnixNano()
+	traceID, spanID := gen.NewIDs(ctx)
+	spanID2 := gen.NewSpanID(ctx, traceID)
+	after := time.Now().UnixNano()
+
+	unixNano := int64(binary.BigEndian.Uint64(traceID[:8]))
+	require.GreaterOrEqual(t, unixNano, before)
+	require.LessOrEqual(t, unixNano, after)
+
+	for _, sid := range []trace.SpanID{spanID, spanID2} {
+		millis := binary.BigEndian.Uint32(sid[:4])
+		require.GreaterOrEqual(t, millis, uint32(before/spanIDPrec))
+		require.LessOrEqual(t, millis, uint32(after/spanIDPrec))
+	}
+}
+
+func TestIDGeneratorConcurrent(t *testing.T) {
+	ctx := context.Background()
+	gen := newIDGenerator()
+
+	const numGoroutine = 8
+	const numID = 1000
+
+	var mu sync.Mutex
+	traceIDs := make(map[trace.TraceID]struct{}, numGoroutine*numID)
+
+	var wg sync.WaitGroup
+	for i := 0; i < numGoroutine; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			tids := make([]trace.TraceID, 0, numID)
+			for j := 0; j < numID; j++ {
+				tid, _ := gen.NewIDs(ctx)
+				_ = gen.NewSpanID(ctx, tid)
+				tids = append(tids, tid)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, tid := range tids {
+				traceIDs[tid] = struct{}{}
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, traceIDs, numGoroutine*numID)
+}
+
+func TestIDTime(t *testing.T) {
+	ctx := context.Background()
+	gen := NewTimeOrderedIDGenerator()
+
+	before := time.Now()
+	traceID, spanID := gen.NewIDs(ctx)
+	after := time.Now()
+
+	tm := TraceIDTime(traceID)
+	require.False(t, tm.Before(before.Truncate(0)))
+	require.False(t, tm.After(after.Truncate(0)))
+
+	spanTime := SpanIDTime(spanID, tm)
+	require.Equal(t, tm.Truncate(time.Millisecond), spanTime)
+	require.Equal(t, uint32(tm.UnixMilli()), SpanIDMillis(spanID))
+
+	// The millisecond counter wraps around.
+	ref := time.UnixMilli(1<<32 - 10)
+	spanID = newSpanID(time.UnixMilli(1<<32 + 10).UnixNano())
+	require.Equal(t, uint32(10), SpanIDMillis(spanID))
+	require.Equal(t, time.UnixMilli(1<<32+10), SpanIDTime(spanID, ref))
+
+	spanID = newSpanID(time.UnixMilli(1<<32 - 20).UnixNano())
+	require.Equal(t, time.UnixMilli(1<<32-20), SpanIDTime(spanID, time.UnixMilli(1<<32+5)))
+}
+
+func TestRandomIDGenerator(t *testing.T) {
+	ctx := context.Background()
+	gen := NewRandomIDGenerator()
+
+	traceID1, spanID1 := gen.NewIDs(ctx)
+	traceID2, spanID2 := gen.NewIDs(ctx)
+	require.True(t, traceID1.IsValid())
+	require.True(t, spanID1.IsValid())
+	require.NotEqual(t, traceID1, traceID2)
+	require.NotEqual(t, spanID1, spanID2)
+	require.NotEqual(t, spanID1, gen.NewSpanID(ctx, traceID1))
+}
+
+type fixedIDGenerator struct{}
+
+func (fixedIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	return trace.TraceID{1}, trace.SpanID{2}
+}
+
+func (fixedIDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	return trace.SpanID{3}
+}
+
+func TestWithIDGenerator(t *testing.T) {
+	ctx := context.Background()
+
+	client, err := New(ctx,
+		WithFileExporter(t.TempDir()),
+		WithIDGenerator(fixedIDGenerator{}),
+		WithMetricsDisabled(),
+		WithLoggingDisabled(),
+		WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	tracer := client.TracerProvider().Tracer("test")
+	ctx, span := tracer.Start(ctx, "root")
+	_, child := tracer.Start(ctx, "child")
+	require.Equal(t, trace.TraceID{1}, span.SpanContext().TraceID())
+	require.Equal(t, trace.SpanID{2}, span.SpanContext().SpanID())
+	require.Equal(t, trace.SpanID{3}, child.SpanContext().SpanID())
+	child.End()
+	span.End()
+}
+
+func BenchmarkIDGenerator(b *testing.B) {
+	ctx := context.Background()
+	gen := newIDGenerator()
+
+	b.Run("NewIDs", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_, _ = gen.NewIDs(ctx)
+			}
+		})
+	})
+
+	b.Run("NewSpanID", func(b *testing.B) {
+		traceID, _ := gen.NewIDs(ctx)
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_ = gen.NewSpanID(ctx, traceID)
+			}
+		})
+	})
+}
+
 func TestSpanPrecision(t *testing.T) {
 	dur := time.Duration(math.MaxUint32) * time.Duration(spanIDPrec)
 	require.Equal(t, "1193h2m47.295s", dur.String())
 }
+
+func TestExportStatsQueue(t *testing.T) {
+	s := newExportStats("http://xxxxx@localhost/1", SignalTraces)
+
+	for i := 0; i < 5; i++ {
+		s.enqueue(1, 3)
+	}
+	require.Equal(t, int64(3), s.queueSize.Load())
+	require.Equal(t, int64(2), s.dropped.Load())
+
+	s.dequeue(2)
+	require.Equal(t, int64(1), s.queueSize.Load())
+
+	// The estimate never goes below zero.
+	s.dequeue(5)
+	require.Equal(t, int64(0), s.queueSize.Load())
+}
@@ -2,76 +2,148 @@ package uptrace
 
 import (
 	"context"
-	"log/slog"
-	"time"
+	"fmt"
 
 	"go.opentelemetry.io/contrib/processors/minsev"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
 	"go.opentelemetry.io/otel/log"
-	"go.opentelemetry.io/otel/log/global"
 	sdklog "go.opentelemetry.io/otel/sdk/log"
 )
 
-func configureLogging(ctx context.Context, conf *config) *sdklog.LoggerProvider {
+func configureLogging(ctx context.Context, conf *config) (*sdklog.LoggerProvider, error) {
 	var opts []sdklog.LoggerProviderOption
 	if res := conf.newResource(); res != nil {
 		opts = append(opts, sdklog.WithResource(res))
 	}
 
-	for _, dsn := range conf.dsn {
-		dsn, err := ParseDSN(dsn)
+	exporters := make([]sdklog.Exporter, len(conf.transports))
+	for i, t := range conf.transports {
+		exp, err := newOtlpLogExporter(ctx, conf, t)
 		if err != nil {
-			slog.Error("ParseDSN failed", slog.Any("err", err))
-			continue
+			return nil, fmt.Errorf("newOtlpLogExporter failed: %w", err)
 		}
+		exporters[i] = exp
+	}
 
-		exp, err := newOtlpLogExporter(ctx, conf, dsn)
-		if err != nil {
-			slog.Error("otlploghttp.New failed: %s", slog.Any("err", err))
-			continue
-		}
+	newProcessor := func(exp sdklog.Exporter, queue *exportStats) sdklog.Processor {
+		bsp := sdklog.NewBatchProcessor(exp,
+			sdklog.WithMaxQueueSize(conf.logBatch.maxQueueSize),
+			sdklog.WithExportMaxBatchSize(conf.logBatch.maxExportBatchSize),
+			sdklog.WithExportInterval(conf.logBatch.scheduleDelay),
+			sdklog.WithExportTimeout(conf.logBatch.exportTimeout),
+		)
 
-		queueSize := queueSize()
-		bspOptions := []sdklog.BatchProcessorOption{
-			sdklog.WithMaxQueueSize(queueSize),
-			sdklog.WithExportMaxBatchSize(queueSize),
-			sdklog.WithExportInterval(10 * time.Second),
-			sdklog.WithExportTimeout(10 * time.Second),
+		var processor sdklog.Processor = &queuedLogProcessor{
+			Processor:    bsp,
+			stats:        queue,
+			maxQueueSize: int64(conf.logBatch.maxQueueSize),
 		}
-		bsp := sdklog.NewBatchProcessor(exp, bspOptions...)
-
-		var processor sdklog.Processor = bsp
 		if conf.logMinSeverity != log.SeverityUndefined {
 			// Convert from log.Severity (1-24 scale) to minsev.Severity (-8 to 15 scale).
 			const sevOffset = int(log.SeverityTrace1) - int(minsev.SeverityTrace1)
 			sev := minsev.Severity(int(conf.logMinSeverity) - sevOffset)
-			processor = minsev.NewLogProcessor(bsp, sev)
+			processor = minsev.NewLogProcessor(processor, sev)
 		}
-		opts = append(opts, sdklog.WithProcessor(processor))
+		return processor
 	}
 
-	provider := sdklog.NewLoggerProvider(opts...)
-	global.SetLoggerProvider(provider)
+	if conf.failover != nil {
+		// In the failover mode, the queue size is reported for the first DSN.
+		queue := conf.transports[0].signalStats(SignalLogs)
+		for i, t := range conf.transports {
+			exporters[i] = &logExporter{
+				Exporter: exporters[i],
+				stats:    t.signalStats(SignalLogs),
+			}
+		}
+		opts = append(opts, sdklog.WithProcessor(newProcessor(&failoverLogExporter{
+			failover:  conf.failover,
+			exporters: exporters,
+			queue:     queue,
+		}, queue)))
+	} else {
+		for i, t := range conf.transports {
+			stats := t.signalStats(SignalLogs)
+			opts = append(opts, sdklog.WithProcessor(newProcessor(&logExporter{
+				Exporter: exporters[i],
+				stats:    stats,
+				queue:    stats,
+			}, stats)))
+		}
+	}
 
-	return provider
+	if conf.fileExporter != nil {
+		exp, err := conf.fileExporter.logExporter(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("otlploghttp.New failed: %w", err)
+		}
+		stats := conf.fileExporter.signalStats(SignalLogs)
+		opts = append(opts, sdklog.WithProcessor(newProcessor(&logExporter{
+			Exporter: exp,
+			stats:    stats,
+			queue:    stats,
+		}, stats)))
+	}
+
+	return sdklog.NewLoggerProvider(opts...), nil
 }
 
 func newOtlpLogExporter(
-	ctx context.Context, conf *config, dsn *DSN,
-) (*otlploghttp.Exporter, error) {
+	ctx context.Context, conf *config, t *transport,
+) (sdklog.Exporter, error) {
+	if t.protocol == ProtocolGRPC {
+		options := []otlploggrpc.Option{
+			otlploggrpc.WithGRPCConn(t.grpcConn),
+			otlploggrpc.WithHeaders(conf.otlpHeaders(t.dsn)),
+			otlploggrpc.WithTimeout(conf.otlpTimeout()),
+		}
+		if conf.retry != nil {
+			options = append(options, otlploggrpc.WithRetry(otlploggrpc.RetryConfig(*conf.retry)))
+		}
+		return otlploggrpc.New(ctx, options...)
+	}
+
 	options := []otlploghttp.Option{
-		otlploghttp.WithEndpoint(dsn.OTLPHttpEndpoint()),
-		otlploghttp.WithHeaders(map[string]string{
-			"uptrace-dsn": dsn.String(),
-		}),
+		otlploghttp.WithEndpoint(t.dsn.OTLPHttpEndpoint()),
+		otlploghttp.WithURLPath(t.dsn.OTLPHttpPath("/v1/logs")),
+		otlploghttp.WithHTTPClient(t.httpClient),
+		otlploghttp.WithHeaders(conf.otlpHeaders(t.dsn)),
 		otlploghttp.WithCompression(otlploghttp.GzipCompression),
 	}
-
-	if conf.tlsConf != nil {
-		options = append(options, otlploghttp.WithTLSClientConfig(conf.tlsConf))
-	} else if dsn.Scheme == "http" {
+	if t.dsn.Scheme == "http" {
 		options = append(options, otlploghttp.WithInsecure())
 	}
-
+	if conf.retry != nil {
+		options = append(options, otlploghttp.WithRetry(otlploghttp.RetryConfig(*conf.retry)))
+	}
 	return otlploghttp.New(ctx, options...)
 }
+
+// logExporter records export stats. Exported records are removed from the queue
+// stats unless the queue is nil.
+type logExporter struct {
+	sdklog.Exporter
+	stats *exportStats
+	queue *exportStats
+}
+
+func (e *logExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	e.queue.dequeue(int64(len(records)))
+	return e.stats.export(ctx, len(records), func(ctx context.Context) error {
+		return e.Exporter.Export(ctx, records)
+	})
+}
+
+// queuedLogProcessor tracks the number of records queued by the batch processor.
+// The batch processor decides whether to drop records when its queue is full.
+type queuedLogProcessor struct {
+	sdklog.Processor
+	stats        *exportStats
+	maxQueueSize int64
+}
+
+func (p *queuedLogProcessor) OnEmit(ctx context.Context, r *sdklog.Record) error {
+	p.stats.enqueue(1, p.maxQueueSize)
+	return p.Processor.OnEmit(ctx, r)
+}
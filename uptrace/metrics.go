@@ -2,71 +2,89 @@ package uptrace
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
-	"time"
 
 	runtimemetrics "go.opentelemetry.io/contrib/instrumentation/runtime"
-	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/metric/metricdata"
-
-	"github.com/uptrace/uptrace-go/internal"
 )
 
-func configureMetrics(ctx context.Context, conf *config) *sdkmetric.MeterProvider {
+func configureMetrics(ctx context.Context, conf *config) (*sdkmetric.MeterProvider, error) {
 	opts := conf.metricOptions
 	if res := conf.newResource(); res != nil {
 		opts = append(opts, sdkmetric.WithResource(res))
 	}
 
-	for _, dsn := range conf.dsn {
-		dsn, err := ParseDSN(dsn)
+	exporters := make([]sdkmetric.Exporter, len(conf.transports))
+	for i, t := range conf.transports {
+		exp, err := otlpmetricClient(ctx, conf, t)
 		if err != nil {
-			slog.Error("ParseDSN failed", slog.Any("err", err))
-			continue
+			return nil, fmt.Errorf("otlpmetricClient failed: %w", err)
 		}
-
-		exp, err := otlpmetricClient(ctx, conf, dsn)
+		exporters[i] = &metricExporter{
+			Exporter: exp,
+			stats:    t.signalStats(SignalMetrics),
+		}
+	}
+	if conf.failover != nil {
+		exporters = []sdkmetric.Exporter{newFailoverMetricExporter(conf.failover, exporters)}
+	}
+	if conf.fileExporter != nil {
+		exp, err := conf.fileExporter.metricExporter(ctx)
 		if err != nil {
-			internal.Logger.Printf("otlpmetricClient failed: %s", err)
-			continue
+			return nil, fmt.Errorf("otlpmetrichttp.New failed: %w", err)
 		}
+		exporters = append(exporters, &metricExporter{
+			Exporter: exp,
+			stats:    conf.fileExporter.signalStats(SignalMetrics),
+		})
+	}
 
-		reader := sdkmetric.NewPeriodicReader(
-			exp,
-			sdkmetric.WithInterval(15*time.Second),
-		)
+	for _, exp := range exporters {
+		reader := sdkmetric.NewPeriodicReader(exp, sdkmetric.WithInterval(conf.metricInterval))
 		opts = append(opts, sdkmetric.WithReader(reader))
 	}
 
 	provider := sdkmetric.NewMeterProvider(opts...)
-	otel.SetMeterProvider(provider)
 
-	if err := runtimemetrics.Start(); err != nil {
+	if err := runtimemetrics.Start(runtimemetrics.WithMeterProvider(provider)); err != nil {
 		slog.Error("runtimemetrics.Start failed", slog.Any("err", err))
 	}
 
-	return provider
+	return provider, nil
 }
 
-func otlpmetricClient(ctx context.Context, conf *config, dsn *DSN) (sdkmetric.Exporter, error) {
+func otlpmetricClient(ctx context.Context, conf *config, t *transport) (sdkmetric.Exporter, error) {
+	if t.protocol == ProtocolGRPC {
+		options := []otlpmetricgrpc.Option{
+			otlpmetricgrpc.WithGRPCConn(t.grpcConn),
+			otlpmetricgrpc.WithHeaders(conf.otlpHeaders(t.dsn)),
+			otlpmetricgrpc.WithTimeout(conf.otlpTimeout()),
+			otlpmetricgrpc.WithTemporalitySelector(preferDeltaTemporalitySelector),
+		}
+		if conf.retry != nil {
+			options = append(options, otlpmetricgrpc.WithRetry(otlpmetricgrpc.RetryConfig(*conf.retry)))
+		}
+		return otlpmetricgrpc.New(ctx, options...)
+	}
+
 	options := []otlpmetrichttp.Option{
-		otlpmetrichttp.WithEndpoint(dsn.OTLPHttpEndpoint()),
-		otlpmetrichttp.WithHeaders(map[string]string{
-			// Set the Uptrace DSN here or use UPTRACE_DSN env var.
-			"uptrace-dsn": dsn.String(),
-		}),
+		otlpmetrichttp.WithEndpoint(t.dsn.OTLPHttpEndpoint()),
+		otlpmetrichttp.WithURLPath(t.dsn.OTLPHttpPath("/v1/metrics")),
+		otlpmetrichttp.WithHTTPClient(t.httpClient),
+		otlpmetrichttp.WithHeaders(conf.otlpHeaders(t.dsn)),
 		otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression),
 		otlpmetrichttp.WithTemporalitySelector(preferDeltaTemporalitySelector),
 	}
-
-	if conf.tlsConf != nil {
-		options = append(options, otlpmetrichttp.WithTLSClientConfig(conf.tlsConf))
-	} else if dsn.Scheme == "http" {
+	if t.dsn.Scheme == "http" {
 		options = append(options, otlpmetrichttp.WithInsecure())
 	}
-
+	if conf.retry != nil {
+		options = append(options, otlpmetrichttp.WithRetry(otlpmetrichttp.RetryConfig(*conf.retry)))
+	}
 	return otlpmetrichttp.New(ctx, options...)
 }
 
@@ -80,3 +98,44 @@ func preferDeltaTemporalitySelector(kind sdkmetric.InstrumentKind) metricdata.Te
 		return metricdata.CumulativeTemporality
 	}
 }
+
+// metricExporter records export stats.
+type metricExporter struct {
+	sdkmetric.Exporter
+	stats *exportStats
+}
+
+func (e *metricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	return e.stats.export(ctx, countDataPoints(rm), func(ctx context.Context) error {
+		return e.Exporter.Export(ctx, rm)
+	})
+}
+
+func countDataPoints(rm *metricdata.ResourceMetrics) int {
+	var n int
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Gauge[int64]:
+				n += len(data.DataPoints)
+			case metricdata.Gauge[float64]:
+				n += len(data.DataPoints)
+			case metricdata.Sum[int64]:
+				n += len(data.DataPoints)
+			case metricdata.Sum[float64]:
+				n += len(data.DataPoints)
+			case metricdata.Histogram[int64]:
+				n += len(data.DataPoints)
+			case metricdata.Histogram[float64]:
+				n += len(data.DataPoints)
+			case metricdata.ExponentialHistogram[int64]:
+				n += len(data.DataPoints)
+			case metricdata.ExponentialHistogram[float64]:
+				n += len(data.DataPoints)
+			case metricdata.Summary:
+				n += len(data.DataPoints)
+			}
+		}
+	}
+	return n
+}
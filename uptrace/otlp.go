@@ -0,0 +1,44 @@
+package uptrace
+
+import (
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLP/gRPC export methods.
+const (
+	grpcTracesMethod  = "/opentelemetry.proto.collector.trace.v1.TraceService/Export"
+	grpcMetricsMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	grpcLogsMethod    = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+)
+
+// grpcExportMethod returns the OTLP/gRPC export method for the signal.
+func grpcExportMethod(signal Signal) string {
+	switch signal {
+	case SignalTraces:
+		return grpcTracesMethod
+	case SignalMetrics:
+		return grpcMetricsMethod
+	default:
+		return grpcLogsMethod
+	}
+}
+
+// newGRPCExportMessages returns empty request and response messages for the OTLP/gRPC method.
+func newGRPCExportMessages(method string) (req, resp proto.Message, ok bool) {
+	switch method {
+	case grpcTracesMethod:
+		return new(collectortrace.ExportTraceServiceRequest),
+			new(collectortrace.ExportTraceServiceResponse), true
+	case grpcMetricsMethod:
+		return new(collectormetrics.ExportMetricsServiceRequest),
+			new(collectormetrics.ExportMetricsServiceResponse), true
+	case grpcLogsMethod:
+		return new(collectorlogs.ExportLogsServiceRequest),
+			new(collectorlogs.ExportLogsServiceResponse), true
+	default:
+		return nil, nil, false
+	}
+}
@@ -0,0 +1,93 @@
+package uptrace
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// proxyDialer returns a gRPC dialer that connects to the address through
+// the HTTP proxy using the CONNECT method.
+func proxyDialer(proxyURL *url.URL) func(ctx context.Context, addr string) (net.Conn, error) {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		proxyAddr := proxyURL.Host
+		if proxyURL.Port() == "" {
+			if proxyURL.Scheme == "https" {
+				proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "443")
+			} else {
+				proxyAddr = net.JoinHostPort(proxyURL.Hostname(), "80")
+			}
+		}
+
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+		if err != nil {
+			return nil, err
+		}
+
+		if proxyURL.Scheme == "https" {
+			tlsConn := tls.Client(conn, &tls.Config{
+				ServerName: proxyURL.Hostname(),
+				MinVersion: tls.VersionTLS12,
+			})
+			if err := tlsConn.HandshakeContext(ctx); err != nil {
+				_ = conn.Close()
+				return nil, err
+			}
+			conn = tlsConn
+		}
+
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+
+		req := &http.Request{
+			Method: http.MethodConnect,
+			URL:    &url.URL{Host: addr},
+			Host:   addr,
+			Header: make(http.Header),
+		}
+		if user := proxyURL.User; user != nil {
+			password, _ := user.Password()
+			auth := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+			req.Header.Set("Proxy-Authorization", "Basic "+auth)
+		}
+		if err := req.Write(conn); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, req)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			_ = conn.Close()
+			return nil, fmt.Errorf("proxy %s responded with %s", proxyURL.Host, resp.Status)
+		}
+
+		_ = conn.SetDeadline(time.Time{})
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+}
+
+// bufferedConn is a net.Conn that first reads the data buffered
+// while reading the proxy response.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
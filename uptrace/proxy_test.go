@@ -0,0 +1,194 @@
+package uptrace_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+
+	"github.com/uptrace/uptrace-go/uptrace"
+)
+
+func TestHTTPProxy(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var requests []*http.Request
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.Copy(io.Discard, req.Body)
+
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+	}))
+	defer proxy.Close()
+
+	client, err := uptrace.New(ctx,
+		uptrace.WithDSN("http://token@uptrace.invalid:14318/1"),
+		uptrace.WithProxy("http://user:secret@"+proxy.Listener.Addr().String()),
+		uptrace.WithHeaders(map[string]string{"x-static": "static"}),
+		uptrace.WithHeadersFunc(func(ctx context.Context) map[string]string {
+			return map[string]string{"x-dynamic": "dynamic"}
+		}),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	_, span := client.TracerProvider().Tracer("test").Start(ctx, "hello")
+	span.End()
+	require.NoError(t, client.ForceFlush(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Len(t, requests, 1)
+	req := requests[0]
+	require.Equal(t, "http://uptrace.invalid:14318/v1/traces", req.RequestURI)
+	require.Equal(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("user:secret")),
+		req.Header.Get("Proxy-Authorization"))
+	require.Equal(t, "static", req.Header.Get("x-static"))
+	require.Equal(t, "dynamic", req.Header.Get("x-dynamic"))
+	require.Equal(t, "http://token@uptrace.invalid:14318/1", req.Header.Get("uptrace-dsn"))
+}
+
+func TestGRPCProxy(t *testing.T) {
+	ctx := context.Background()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	traceServer := new(traceServer)
+	srv := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(srv, traceServer)
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	proxy := newConnectProxy(t)
+	defer proxy.Close()
+
+	client, err := uptrace.New(ctx,
+		uptrace.WithDSN("http://token@"+ln.Addr().String()+"/1?protocol=grpc"),
+		uptrace.WithProxy("http://"+proxy.Addr().String()),
+		uptrace.WithHeadersFunc(func(ctx context.Context) map[string]string {
+			return map[string]string{"x-dynamic": "dynamic"}
+		}),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	_, span := client.TracerProvider().Tracer("test").Start(ctx, "hello")
+	span.End()
+	require.NoError(t, client.ForceFlush(ctx))
+
+	require.Equal(t, int64(1), proxy.connects.Load())
+
+	traceServer.mu.Lock()
+	defer traceServer.mu.Unlock()
+
+	require.Equal(t, 1, traceServer.spans)
+	require.Equal(t, []string{"dynamic"}, traceServer.md.Get("x-dynamic"))
+}
+
+type connectProxy struct {
+	net.Listener
+	connects atomic.Int64
+}
+
+func newConnectProxy(t *testing.T) *connectProxy {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	proxy := &connectProxy{Listener: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go proxy.serve(conn)
+		}
+	}()
+	return proxy
+}
+
+func (p *connectProxy) serve(conn net.Conn) {
+	defer conn.Close()
+
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
+	if err != nil || req.Method != http.MethodConnect {
+		return
+	}
+	p.connects.Add(1)
+
+	target, err := net.Dial("tcp", req.Host)
+	if err != nil {
+		_, _ = io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	defer target.Close()
+
+	_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+	go func() {
+		_, _ = io.Copy(target, br)
+		_ = target.Close()
+	}()
+	_, _ = io.Copy(conn, target)
+}
+
+func TestRoundTripperAndRetry(t *testing.T) {
+	ctx := context.Background()
+
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	rt := &countingRoundTripper{next: http.DefaultTransport}
+	client, err := uptrace.New(ctx,
+		uptrace.WithDSN("http://token@"+srv.Listener.Addr().String()+"/1"),
+		uptrace.WithRoundTripper(rt),
+		uptrace.WithRetry(uptrace.RetryConfig{Enabled: false}),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	_, span := client.TracerProvider().Tracer("test").Start(ctx, "hello")
+	span.End()
+	require.Error(t, client.ForceFlush(ctx))
+
+	require.Equal(t, int64(1), requests.Load())
+	require.Equal(t, int64(1), rt.n.Load())
+}
+
+type countingRoundTripper struct {
+	next http.RoundTripper
+	n    atomic.Int64
+}
+
+func (rt *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.n.Add(1)
+	return rt.next.RoundTrip(req)
+}
@@ -0,0 +1,269 @@
+package uptrace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/uptrace-go/internal"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultRemoteSamplerPollInterval = time.Minute
+
+	remoteSamplerTimeout  = 10 * time.Second
+	maxRemoteStrategySize = 1 << 20
+)
+
+type remoteSamplerConfig struct {
+	pollInterval time.Duration
+	fallback     sdktrace.Sampler
+}
+
+// RemoteSamplerOption configures the sampler created with NewRemoteSampler or WithRemoteSampler.
+type RemoteSamplerOption func(conf *remoteSamplerConfig)
+
+// WithRemoteSamplerPollInterval configures how often the sampling strategy is fetched.
+// The default is 1 minute. Non-positive values are ignored.
+func WithRemoteSamplerPollInterval(d time.Duration) RemoteSamplerOption {
+	return func(conf *remoteSamplerConfig) {
+		if d > 0 {
+			conf.pollInterval = d
+		}
+	}
+}
+
+// WithRemoteSamplerFallback configures the sampler that is used until the sampling
+// strategy is fetched. The default is to sample all traces.
+func WithRemoteSamplerFallback(sampler sdktrace.Sampler) RemoteSamplerOption {
+	return func(conf *remoteSamplerConfig) {
+		conf.fallback = sampler
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// RemoteSampler periodically fetches the sampling strategy from a URL and uses it
+// to sample traces.
+type RemoteSampler struct {
+	url  string
+	conf remoteSamplerConfig
+
+	client  *http.Client
+	sampler atomic.Pointer[remoteStrategy]
+	body    []byte // the last fetched strategy; only used by the poll goroutine
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+type remoteStrategy struct {
+	sampler sdktrace.Sampler
+}
+
+var _ sdktrace.Sampler = (*RemoteSampler)(nil)
+
+// NewRemoteSampler returns a sampler that fetches the sampling strategy from the URL
+// every minute. The strategy is either in the Jaeger remote sampling format, for example,
+//
+//	{"strategyType": "PROBABILISTIC", "probabilisticSampling": {"samplingRate": 0.5}}
+//
+// or a list of sampling rules using the same format as the `rule_based` sampler
+// in the config file, for example,
+//
+//	{"rules": [{"attributes": [{"name": "http.route", "value": "/healthz"}], "ratio": 0},
+//	  {"ratio": 0.05}]}
+//
+// Jaeger per-operation strategies match the span name, and the lower bound of
+// traces per second is not supported.
+//
+// When the URL is unavailable or returns an invalid strategy, the sampler keeps
+// the last fetched strategy, or the fallback sampler if no strategy has been fetched yet.
+// Like NewRateLimitingSampler, the sampler ignores the parent span so it is usually
+// wrapped with sdktrace.ParentBased.
+//
+// The sampler must be stopped with Close.
+func NewRemoteSampler(url string, opts ...RemoteSamplerOption) *RemoteSampler {
+	s := newRemoteSampler(url, opts)
+	s.start()
+	return s
+}
+
+func newRemoteSampler(url string, opts []RemoteSamplerOption) *RemoteSampler {
+	s := &RemoteSampler{
+		url: url,
+		conf: remoteSamplerConfig{
+			pollInterval: defaultRemoteSamplerPollInterval,
+			fallback:     sdktrace.AlwaysSample(),
+		},
+		client: &http.Client{Timeout: remoteSamplerTimeout},
+		stop:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(&s.conf)
+	}
+	s.sampler.Store(&remoteStrategy{sampler: s.conf.fallback})
+	return s
+}
+
+func (s *RemoteSampler) start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.poll()
+	}()
+}
+
+func (s *RemoteSampler) poll() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.stop
+		cancel()
+	}()
+
+	ticker := time.NewTicker(s.conf.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.fetch(ctx); err != nil && ctx.Err() == nil {
+			internal.Logger.Printf("can't fetch sampling strategy: %s", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// fetch fetches the sampling strategy and replaces the current sampler when
+// the strategy is changed.
+func (s *RemoteSampler) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("got %s from %s", resp.Status, s.url)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteStrategySize))
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(body, s.body) {
+		// Keep the current sampler so the rate limits are not reset.
+		return nil
+	}
+
+	sampler, err := parseRemoteStrategy(body)
+	if err != nil {
+		return fmt.Errorf("invalid sampling strategy: %w", err)
+	}
+	s.body = body
+	s.sampler.Store(&remoteStrategy{sampler: sampler})
+	return nil
+}
+
+func (s *RemoteSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	return s.sampler.Load().sampler.ShouldSample(p)
+}
+
+func (s *RemoteSampler) Description() string {
+	return fmt.Sprintf("RemoteSampler{%s}", s.sampler.Load().sampler.Description())
+}
+
+// Close stops fetching the sampling strategy. The sampler keeps using the last
+// fetched strategy.
+func (s *RemoteSampler) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	s.wg.Wait()
+	return nil
+}
+
+//------------------------------------------------------------------------------
+
+// fileRemoteStrategy is the union of the Uptrace and Jaeger sampling strategy formats.
+type fileRemoteStrategy struct {
+	Rules []fileSamplingRule `yaml:"rules"`
+
+	StrategyType          string                       `yaml:"strategyType"`
+	ProbabilisticSampling *jaegerProbabilisticSampling `yaml:"probabilisticSampling"`
+	RateLimitingSampling  *struct {
+		MaxTracesPerSecond float64 `yaml:"maxTracesPerSecond"`
+	} `yaml:"rateLimitingSampling"`
+	OperationSampling *struct {
+		DefaultSamplingProbability float64 `yaml:"defaultSamplingProbability"`
+		PerOperationStrategies     []struct {
+			Operation             string                      `yaml:"operation"`
+			ProbabilisticSampling jaegerProbabilisticSampling `yaml:"probabilisticSampling"`
+		} `yaml:"perOperationStrategies"`
+	} `yaml:"operationSampling"`
+}
+
+type jaegerProbabilisticSampling struct {
+	SamplingRate float64 `yaml:"samplingRate"`
+}
+
+// parseRemoteStrategy parses the sampling strategy in the Uptrace or Jaeger format.
+// JSON is parsed as YAML like the config file.
+func parseRemoteStrategy(b []byte) (sdktrace.Sampler, error) {
+	var strategy fileRemoteStrategy
+	if err := yaml.Unmarshal(b, &strategy); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strategy.Rules != nil:
+		return newFileRuleBasedSampler(strategy.Rules)
+	case strategy.OperationSampling != nil:
+		ops := strategy.OperationSampling
+		rules := make([]SamplingRule, 0, len(ops.PerOperationStrategies)+1)
+		for _, op := range ops.PerOperationStrategies {
+			rules = append(rules, SamplingRule{
+				SpanName: op.Operation,
+				Ratio:    op.ProbabilisticSampling.SamplingRate,
+			})
+		}
+		rules = append(rules, SamplingRule{Ratio: ops.DefaultSamplingProbability})
+		return NewRuleBasedSampler(rules...), nil
+	}
+
+	// The strategy type is either a name or an enum value.
+	switch strategy.StrategyType {
+	case "PROBABILISTIC", "0", "":
+		if strategy.ProbabilisticSampling == nil {
+			return nil, errors.New("probabilisticSampling is required")
+		}
+		return newRatioSampler(strategy.ProbabilisticSampling.SamplingRate), nil
+	case "RATE_LIMITING", "1":
+		if strategy.RateLimitingSampling == nil {
+			return nil, errors.New("rateLimitingSampling is required")
+		}
+		return NewRateLimitingSampler(strategy.RateLimitingSampling.MaxTracesPerSecond), nil
+	default:
+		return nil, fmt.Errorf("unsupported strategyType: %q", strategy.StrategyType)
+	}
+}
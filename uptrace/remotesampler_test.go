@@ -0,0 +1,212 @@
+package uptrace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+type strategyServer struct {
+	mu       sync.Mutex
+	status   int
+	strategy string
+	services []string
+}
+
+func (s *strategyServer) set(status int, strategy string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+	s.strategy = strategy
+}
+
+func (s *strategyServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.services = append(s.services, req.URL.Query().Get("service"))
+	w.WriteHeader(s.status)
+	_, _ = w.Write([]byte(s.strategy))
+}
+
+func TestRemoteSampler(t *testing.T) {
+	ctx := context.Background()
+
+	handler := new(strategyServer)
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	sampler := newRemoteSampler(srv.URL, []RemoteSamplerOption{
+		WithRemoteSamplerFallback(sdktrace.NeverSample()),
+	})
+	require.Equal(t, "RemoteSampler{AlwaysOffSampler}", sampler.Description())
+
+	handler.set(http.StatusServiceUnavailable, "")
+	require.Error(t, sampler.fetch(ctx))
+	require.Equal(t, "RemoteSampler{AlwaysOffSampler}", sampler.Description())
+
+	handler.set(http.StatusOK,
+		`{"strategyType": "PROBABILISTIC", "probabilisticSampling": {"samplingRate": 0.5}}`)
+	require.NoError(t, sampler.fetch(ctx))
+	require.Equal(t, "RemoteSampler{TraceIDRatioBased{0.5}}", sampler.Description())
+
+	// The last fetched strategy is kept on errors.
+	handler.set(http.StatusOK, `{"strategyType": "UNKNOWN"}`)
+	err := sampler.fetch(ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `unsupported strategyType: "UNKNOWN"`)
+	require.Equal(t, "RemoteSampler{TraceIDRatioBased{0.5}}", sampler.Description())
+
+	srv.Close()
+	require.Error(t, sampler.fetch(ctx))
+	require.Equal(t, "RemoteSampler{TraceIDRatioBased{0.5}}", sampler.Description())
+}
+
+func TestRemoteSamplerPoll(t *testing.T) {
+	handler := new(strategyServer)
+	handler.set(http.StatusOK, `{"rules": [{"ratio": 0}]}`)
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	sampler := NewRemoteSampler(srv.URL, WithRemoteSamplerPollInterval(10*time.Millisecond))
+	defer sampler.Close()
+
+	require.Eventually(t, func() bool {
+		return sampler.Description() == "RemoteSampler{RuleBasedSampler{TraceIDRatioBased{0}}}"
+	}, time.Second, 5*time.Millisecond)
+
+	handler.set(http.StatusOK, `{"strategyType": "RATE_LIMITING", "rateLimitingSampling": {"maxTracesPerSecond": 5}}`)
+	require.Eventually(t, func() bool {
+		return sampler.Description() == "RemoteSampler{RateLimitingSampler{5}}"
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, sampler.Close())
+	require.NoError(t, sampler.Close())
+}
+
+func TestRemoteSamplerPollIntervalInvalid(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Second} {
+		sampler := NewRemoteSampler("http://localhost:0", WithRemoteSamplerPollInterval(d))
+		require.Equal(t, defaultRemoteSamplerPollInterval, sampler.conf.pollInterval)
+		require.NoError(t, sampler.Close())
+	}
+}
+
+func TestParseRemoteStrategy(t *testing.T) {
+	tests := []struct {
+		strategy string
+		wanted   string
+	}{
+		{
+			`{"strategyType": 0, "probabilisticSampling": {"samplingRate": 0.1}}`,
+			"TraceIDRatioBased{0.1}",
+		},
+		{
+			`{"probabilisticSampling": {"samplingRate": 1}}`,
+			"TraceIDRatioBased{1}",
+		},
+		{
+			`{"strategyType": 1, "rateLimitingSampling": {"maxTracesPerSecond": 10}}`,
+			"RateLimitingSampler{10}",
+		},
+		{
+			`{
+				"strategyType": "PROBABILISTIC",
+				"probabilisticSampling": {"samplingRate": 0.5},
+				"operationSampling": {
+					"defaultSamplingProbability": 0.01,
+					"defaultLowerBoundTracesPerSecond": 1,
+					"perOperationStrategies": [
+						{"operation": "GET /healthz", "probabilisticSampling": {"samplingRate": 0}},
+						{"operation": "POST /checkout", "probabilisticSampling": {"samplingRate": 1}}
+					]
+				}
+			}`,
+			"RuleBasedSampler{TraceIDRatioBased{0},TraceIDRatioBased{1},TraceIDRatioBased{0.01}}",
+		},
+		{
+			`{"rules": [
+				{"attributes": [{"name": "http.route", "value": "/healthz"}], "ratio": 0},
+				{"span_kind": "server", "rate_limit": 100},
+				{"ratio": 0.05}
+			]}`,
+			"RuleBasedSampler{TraceIDRatioBased{0},RateLimitingSampler{100},TraceIDRatioBased{0.05}}",
+		},
+		{`{"rules": []}`, "RuleBasedSampler{}"},
+	}
+	for _, test := range tests {
+		sampler, err := parseRemoteStrategy([]byte(test.strategy))
+		require.NoError(t, err, test.strategy)
+		require.Equal(t, test.wanted, sampler.Description(), test.strategy)
+	}
+
+	for _, strategy := range []string{
+		`{}`,
+		`{"strategyType": "RATE_LIMITING"}`,
+		`{"rules": [{"span_kind": "server"}]}`,
+		`[`,
+	} {
+		_, err := parseRemoteStrategy([]byte(strategy))
+		require.Error(t, err, strategy)
+	}
+}
+
+func TestWithRemoteSampler(t *testing.T) {
+	ctx := context.Background()
+
+	handler := new(strategyServer)
+	handler.set(http.StatusOK, `{"strategyType": "PROBABILISTIC", "probabilisticSampling": {"samplingRate": 0}}`)
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	client, err := New(ctx,
+		WithFileExporter(t.TempDir()),
+		WithServiceName("myservice"),
+		WithTraceSampler(sdktrace.NeverSample()),
+		WithRemoteSampler(srv.URL+"/sampling", WithRemoteSamplerPollInterval(time.Hour)),
+		WithMetricsDisabled(),
+		WithLoggingDisabled(),
+		WithoutGlobals(),
+	)
+	require.NoError(t, err)
+
+	sampler := client.remoteSampler
+	require.NotNil(t, sampler)
+	require.Eventually(t, func() bool {
+		return sampler.Description() == "RemoteSampler{TraceIDRatioBased{0}}"
+	}, time.Second, 5*time.Millisecond)
+
+	handler.mu.Lock()
+	require.Equal(t, []string{"myservice"}, handler.services)
+	handler.mu.Unlock()
+
+	handler.set(http.StatusOK, `{"strategyType": "PROBABILISTIC", "probabilisticSampling": {"samplingRate": 1}}`)
+	require.NoError(t, sampler.fetch(ctx))
+
+	tracer := client.TracerProvider().Tracer("test")
+	ctx, span := tracer.Start(ctx, "root")
+	require.True(t, span.SpanContext().IsSampled())
+	span.End()
+
+	require.NoError(t, client.Shutdown(ctx))
+	require.Nil(t, client.remoteSampler)
+}
+
+func TestWithRemoteSamplerFallback(t *testing.T) {
+	conf, err := newConfig([]Option{
+		WithTraceSampler(sdktrace.NeverSample()),
+		WithRemoteSampler("http://localhost:1/sampling?service=api"),
+	})
+	require.NoError(t, err)
+
+	sampler := newConfigRemoteSampler(conf, nil)
+	defer sampler.Close()
+
+	require.Equal(t, "http://localhost:1/sampling?service=api", sampler.url)
+	require.Equal(t, "RemoteSampler{AlwaysOffSampler}", sampler.Description())
+}
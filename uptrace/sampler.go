@@ -0,0 +1,278 @@
+package uptrace
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SamplingProbabilityKey is the span attribute that records the probability
+// with which the span was sampled. Uptrace uses it to extrapolate span counts.
+const SamplingProbabilityKey = attribute.Key("sampling.probability")
+
+// rateLimitingSampler samples at most the configured number of traces per second
+// using a token bucket.
+type rateLimitingSampler struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu         sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+
+	// The arrival rate is measured over 1-second windows to estimate
+	// the effective sampling probability.
+	windowStart time.Time
+	windowCount float64
+	arrivalRate float64
+}
+
+var _ sdktrace.Sampler = (*rateLimitingSampler)(nil)
+
+// NewRateLimitingSampler returns a sampler that samples at most tracesPerSecond traces
+// per second using a token bucket that allows bursts of up to 1 second of traces.
+// Sampled spans record the effective sampling probability using the
+// SamplingProbabilityKey attribute.
+//
+// The sampler ignores the parent span so it should be used as the root sampler of
+// sdktrace.ParentBased, for example, using NewParentBasedRateLimitingSampler.
+func NewRateLimitingSampler(tracesPerSecond float64) sdktrace.Sampler {
+	return newRateLimitingSampler(tracesPerSecond, time.Now)
+}
+
+func newRateLimitingSampler(tracesPerSecond float64, now func() time.Time) *rateLimitingSampler {
+	if tracesPerSecond < 0 {
+		tracesPerSecond = 0
+	}
+	tm := now()
+	s := &rateLimitingSampler{
+		rate:        tracesPerSecond,
+		burst:       math.Max(tracesPerSecond, 1),
+		now:         now,
+		lastRefill:  tm,
+		windowStart: tm,
+	}
+	s.tokens = s.burst
+	if tracesPerSecond == 0 {
+		s.tokens = 0
+	}
+	return s
+}
+
+// NewParentBasedRateLimitingSampler returns a sampler that samples at most
+// tracesPerSecond new root traces per second. Child spans follow the sampling
+// decision of their parent span.
+func NewParentBasedRateLimitingSampler(
+	tracesPerSecond float64, opts ...sdktrace.ParentBasedSamplerOption,
+) sdktrace.Sampler {
+	return sdktrace.ParentBased(NewRateLimitingSampler(tracesPerSecond), opts...)
+}
+
+func (s *rateLimitingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	psc := trace.SpanContextFromContext(p.ParentContext)
+
+	sampled, probability := s.take()
+	if !sampled {
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.Drop,
+			Tracestate: psc.TraceState(),
+		}
+	}
+	return sdktrace.SamplingResult{
+		Decision:   sdktrace.RecordAndSample,
+		Attributes: []attribute.KeyValue{SamplingProbabilityKey.Float64(probability)},
+		Tracestate: psc.TraceState(),
+	}
+}
+
+// take takes a token from the bucket and returns the estimated sampling probability.
+func (s *rateLimitingSampler) take() (bool, float64) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elapsed := now.Sub(s.lastRefill).Seconds(); elapsed > 0 {
+		s.tokens = math.Min(s.burst, s.tokens+elapsed*s.rate)
+		s.lastRefill = now
+	}
+
+	if elapsed := now.Sub(s.windowStart); elapsed >= time.Second {
+		s.arrivalRate = s.windowCount / elapsed.Seconds()
+		s.windowStart = now
+		s.windowCount = 0
+	}
+	s.windowCount++
+
+	if s.tokens < 1 {
+		return false, 0
+	}
+	s.tokens--
+
+	// The current window underestimates the arrival rate until it is complete.
+	arrivalRate := math.Max(s.arrivalRate, s.windowCount)
+	return true, math.Min(1, s.rate/arrivalRate)
+}
+
+func (s *rateLimitingSampler) Description() string {
+	return fmt.Sprintf("RateLimitingSampler{%g}", s.rate)
+}
+
+//------------------------------------------------------------------------------
+
+// SamplingRule selects spans by name, kind, and attributes, and samples the matching
+// spans using either a ratio or a rate limit.
+type SamplingRule struct {
+	// SpanName matches the span name. Empty name matches any span.
+	SpanName string
+	// SpanKind matches the span kind. trace.SpanKindUnspecified matches any kind.
+	SpanKind trace.SpanKind
+	// Attributes match the attributes provided when the span is started, for example,
+	// http.route. Values are compared using their string representation.
+	Attributes []attribute.KeyValue
+
+	// Ratio is the fraction of the matching traces to sample, from 0 to 1.
+	Ratio float64
+	// RateLimit, when positive, samples at most RateLimit matching traces per second
+	// instead of using Ratio.
+	RateLimit float64
+}
+
+func (r *SamplingRule) match(p *sdktrace.SamplingParameters) bool {
+	if r.SpanName != "" && r.SpanName != p.Name {
+		return false
+	}
+	if r.SpanKind != trace.SpanKindUnspecified && r.SpanKind != p.Kind {
+		return false
+	}
+	for _, want := range r.Attributes {
+		if !hasAttribute(p.Attributes, want) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, kv := range attrs {
+		if kv.Key == want.Key {
+			return kv.Value.Emit() == want.Value.Emit()
+		}
+	}
+	return false
+}
+
+func (r *SamplingRule) sampler() sdktrace.Sampler {
+	if r.RateLimit > 0 {
+		return NewRateLimitingSampler(r.RateLimit)
+	}
+	return newRatioSampler(r.Ratio)
+}
+
+type ruleSampler struct {
+	rule    SamplingRule
+	sampler sdktrace.Sampler
+}
+
+type ruleBasedSampler struct {
+	rules []ruleSampler
+}
+
+var _ sdktrace.Sampler = (*ruleBasedSampler)(nil)
+
+// NewRuleBasedSampler returns a sampler that uses the first rule matching the span
+// to make the sampling decision, for example:
+//
+//	uptrace.NewRuleBasedSampler(
+//		uptrace.SamplingRule{
+//			Attributes: []attribute.KeyValue{attribute.String("http.route", "/healthz")},
+//			Ratio:      0,
+//		},
+//		uptrace.SamplingRule{
+//			Attributes: []attribute.KeyValue{attribute.String("http.route", "/checkout")},
+//			Ratio:      1,
+//		},
+//		uptrace.SamplingRule{Ratio: 0.05},
+//	)
+//
+// Spans that don't match any rule are sampled. Each rate-limited rule has its own budget.
+// Like NewRateLimitingSampler, the sampler ignores the parent span so it is usually
+// wrapped with sdktrace.ParentBased.
+func NewRuleBasedSampler(rules ...SamplingRule) sdktrace.Sampler {
+	s := &ruleBasedSampler{
+		rules: make([]ruleSampler, len(rules)),
+	}
+	for i := range rules {
+		s.rules[i] = ruleSampler{
+			rule:    rules[i],
+			sampler: rules[i].sampler(),
+		}
+	}
+	return s
+}
+
+func (s *ruleBasedSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for i := range s.rules {
+		rule := &s.rules[i]
+		if rule.rule.match(&p) {
+			return rule.sampler.ShouldSample(p)
+		}
+	}
+	return sdktrace.SamplingResult{
+		Decision:   sdktrace.RecordAndSample,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s *ruleBasedSampler) Description() string {
+	var b strings.Builder
+	b.WriteString("RuleBasedSampler{")
+	for i := range s.rules {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(s.rules[i].sampler.Description())
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ratioSampler is sdktrace.TraceIDRatioBased that records the sampling probability.
+type ratioSampler struct {
+	sdktrace.Sampler
+	ratio float64
+}
+
+func newRatioSampler(ratio float64) ratioSampler {
+	ratio = math.Max(0, math.Min(1, ratio))
+	return ratioSampler{
+		Sampler: sdktrace.TraceIDRatioBased(ratio),
+		ratio:   ratio,
+	}
+}
+
+func (s ratioSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	res := s.Sampler.ShouldSample(p)
+	if res.Decision == sdktrace.RecordAndSample {
+		res.Attributes = append(res.Attributes, SamplingProbabilityKey.Float64(s.ratio))
+	}
+	return res
+}
+
+// parseSpanKind parses a span kind name such as `server` or `client`.
+func parseSpanKind(s string) (trace.SpanKind, error) {
+	name := strings.ToLower(s)
+	for kind := trace.SpanKindInternal; kind <= trace.SpanKindConsumer; kind++ {
+		if kind.String() == name {
+			return kind, nil
+		}
+	}
+	return trace.SpanKindUnspecified, fmt.Errorf("unknown span kind: %q", s)
+}
@@ -0,0 +1,165 @@
+package uptrace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type fakeClock struct {
+	tm time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.tm
+}
+
+func (c *fakeClock) add(d time.Duration) {
+	c.tm = c.tm.Add(d)
+}
+
+func TestRateLimitingSampler(t *testing.T) {
+	clock := &fakeClock{tm: time.Unix(1e9, 0)}
+	sampler := newRateLimitingSampler(2, clock.now)
+	require.Equal(t, "RateLimitingSampler{2}", sampler.Description())
+
+	sample := func(n int) (sampled int, probability float64) {
+		for i := 0; i < n; i++ {
+			res := sampler.ShouldSample(sdktrace.SamplingParameters{
+				ParentContext: context.Background(),
+			})
+			if res.Decision == sdktrace.RecordAndSample {
+				sampled++
+				require.Len(t, res.Attributes, 1)
+				require.Equal(t, SamplingProbabilityKey, res.Attributes[0].Key)
+				probability = res.Attributes[0].Value.AsFloat64()
+			}
+		}
+		return sampled, probability
+	}
+
+	// The bucket starts full.
+	sampled, _ := sample(10)
+	require.Equal(t, 2, sampled)
+
+	// Tokens are refilled over time.
+	clock.add(500 * time.Millisecond)
+	sampled, _ = sample(10)
+	require.Equal(t, 1, sampled)
+
+	// The probability is estimated using the arrival rate of the previous window.
+	clock.add(time.Second)
+	sampled, probability := sample(10)
+	require.Equal(t, 2, sampled)
+	require.InDelta(t, 2.0/20.0*1.5, probability, 0.01)
+}
+
+func TestRateLimitingSamplerZero(t *testing.T) {
+	sampler := NewRateLimitingSampler(0)
+	res := sampler.ShouldSample(sdktrace.SamplingParameters{ParentContext: context.Background()})
+	require.Equal(t, sdktrace.Drop, res.Decision)
+}
+
+func TestParentBasedRateLimitingSampler(t *testing.T) {
+	ctx := context.Background()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(NewParentBasedRateLimitingSampler(1)),
+		sdktrace.WithSpanProcessor(recorder),
+	)
+	defer provider.Shutdown(ctx)
+	tracer := provider.Tracer("test")
+
+	ctx1, root := tracer.Start(ctx, "root1")
+	for i := 0; i < 3; i++ {
+		_, child := tracer.Start(ctx1, "child")
+		child.End()
+	}
+	root.End()
+
+	// The bucket is empty so the second trace is dropped including child spans.
+	ctx2, root := tracer.Start(ctx, "root2")
+	_, child := tracer.Start(ctx2, "child")
+	child.End()
+	root.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 4)
+	for _, span := range spans {
+		require.NotEqual(t, root.SpanContext().TraceID(), span.SpanContext().TraceID())
+	}
+
+	var probability float64
+	for _, kv := range spans[3].Attributes() {
+		if kv.Key == SamplingProbabilityKey {
+			probability = kv.Value.AsFloat64()
+		}
+	}
+	require.Equal(t, "root1", spans[3].Name())
+	require.Equal(t, 1.0, probability)
+}
+
+func TestRuleBasedSampler(t *testing.T) {
+	sampler := NewRuleBasedSampler(
+		SamplingRule{
+			Attributes: []attribute.KeyValue{attribute.String("http.route", "/healthz")},
+			Ratio:      0,
+		},
+		SamplingRule{
+			SpanKind:   trace.SpanKindServer,
+			Attributes: []attribute.KeyValue{attribute.String("http.route", "/checkout")},
+			Ratio:      1,
+		},
+		SamplingRule{
+			SpanName:  "poll",
+			RateLimit: 1,
+		},
+		SamplingRule{
+			Attributes: []attribute.KeyValue{attribute.String("http.response.status_code", "500")},
+			Ratio:      1,
+		},
+		SamplingRule{Ratio: 0},
+	)
+	require.Equal(t, "RuleBasedSampler{TraceIDRatioBased{0},TraceIDRatioBased{1},"+
+		"RateLimitingSampler{1},TraceIDRatioBased{1},TraceIDRatioBased{0}}", sampler.Description())
+
+	sample := func(name string, kind trace.SpanKind, attrs ...attribute.KeyValue) sdktrace.SamplingResult {
+		return sampler.ShouldSample(sdktrace.SamplingParameters{
+			ParentContext: context.Background(),
+			TraceID:       trace.TraceID{0xff},
+			Name:          name,
+			Kind:          kind,
+			Attributes:    attrs,
+		})
+	}
+
+	res := sample("GET /healthz", trace.SpanKindServer, attribute.String("http.route", "/healthz"))
+	require.Equal(t, sdktrace.Drop, res.Decision)
+
+	res = sample("POST /checkout", trace.SpanKindServer, attribute.String("http.route", "/checkout"))
+	require.Equal(t, sdktrace.RecordAndSample, res.Decision)
+	require.Equal(t, []attribute.KeyValue{SamplingProbabilityKey.Float64(1)}, res.Attributes)
+
+	res = sample("POST /checkout", trace.SpanKindClient, attribute.String("http.route", "/checkout"))
+	require.Equal(t, sdktrace.Drop, res.Decision)
+
+	require.Equal(t, sdktrace.RecordAndSample, sample("poll", trace.SpanKindInternal).Decision)
+	require.Equal(t, sdktrace.Drop, sample("poll", trace.SpanKindInternal).Decision)
+
+	// Attribute values are compared using their string representation.
+	res = sample("GET /", trace.SpanKindServer, attribute.Int("http.response.status_code", 500))
+	require.Equal(t, sdktrace.RecordAndSample, res.Decision)
+
+	require.Equal(t, sdktrace.Drop, sample("GET /", trace.SpanKindServer).Decision)
+
+	// Spans that don't match any rule are sampled.
+	sampler = NewRuleBasedSampler(SamplingRule{SpanName: "poll", Ratio: 0})
+	require.Equal(t, sdktrace.RecordAndSample, sample("GET /", trace.SpanKindServer).Decision)
+}
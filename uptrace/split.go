@@ -0,0 +1,497 @@
+package uptrace
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/uptrace/uptrace-go/internal"
+	"github.com/uptrace/uptrace-go/internal/otlpproto"
+
+	collectorlogs "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// fieldOverhead is the maximum size of the tag and the length prefix
+// of an embedded protobuf message.
+const fieldOverhead = 6
+
+// payloadSplitter splits OTLP requests that are larger than the max payload size
+// for the signal into several smaller requests.
+type payloadSplitter struct {
+	maxBytes map[Signal]int
+	// retry configures retrying of the parts that failed after other parts were accepted.
+	retry RetryConfig
+}
+
+func newPayloadSplitter(conf *config) *payloadSplitter {
+	s := &payloadSplitter{
+		maxBytes: conf.maxPayloadBytes,
+		retry: RetryConfig{
+			Enabled:         true,
+			InitialInterval: 5 * time.Second,
+			MaxInterval:     30 * time.Second,
+			MaxElapsedTime:  time.Minute,
+		},
+	}
+	if conf.retry != nil {
+		s.retry = *conf.retry
+	}
+	return s
+}
+
+// split returns the parts of the request. It returns nil if the request
+// does not need to be split and an empty slice if all items are too large.
+func (s *payloadSplitter) split(ctx context.Context, signal Signal, req proto.Message) []proto.Message {
+	maxBytes := s.maxBytes[signal]
+	if maxBytes <= 0 || proto.Size(req) <= maxBytes {
+		return nil
+	}
+
+	parts := make([]proto.Message, 0)
+	var tooLarge []string
+	// tooLargeItems is the number of spans, metric data points, or log records
+	// that are too large.
+	var tooLargeItems int
+
+	switch req := req.(type) {
+	case *collectortrace.ExportTraceServiceRequest:
+		var resources [][]*tracepb.ResourceSpans
+		resources, tooLarge = splitResources(req.ResourceSpans, maxBytes,
+			(*tracepb.ResourceSpans).GetScopeSpans,
+			(*tracepb.ScopeSpans).GetSpans,
+			func(rs *tracepb.ResourceSpans, scopes []*tracepb.ScopeSpans) *tracepb.ResourceSpans {
+				return &tracepb.ResourceSpans{
+					Resource:   rs.Resource,
+					ScopeSpans: scopes,
+					SchemaUrl:  rs.SchemaUrl,
+				}
+			},
+			func(ss *tracepb.ScopeSpans, spans []*tracepb.Span) *tracepb.ScopeSpans {
+				return &tracepb.ScopeSpans{
+					Scope:     ss.Scope,
+					Spans:     spans,
+					SchemaUrl: ss.SchemaUrl,
+				}
+			},
+			func(span *tracepb.Span) string {
+				tooLargeItems++
+				return fmt.Sprintf("span %q (trace_id=%s)", span.Name, hex.EncodeToString(span.TraceId))
+			},
+		)
+		for _, rs := range resources {
+			parts = append(parts, &collectortrace.ExportTraceServiceRequest{ResourceSpans: rs})
+		}
+	case *collectormetrics.ExportMetricsServiceRequest:
+		var resources [][]*metricspb.ResourceMetrics
+		resources, tooLarge = splitResources(req.ResourceMetrics, maxBytes,
+			(*metricspb.ResourceMetrics).GetScopeMetrics,
+			(*metricspb.ScopeMetrics).GetMetrics,
+			func(rm *metricspb.ResourceMetrics, scopes []*metricspb.ScopeMetrics) *metricspb.ResourceMetrics {
+				return &metricspb.ResourceMetrics{
+					Resource:     rm.Resource,
+					ScopeMetrics: scopes,
+					SchemaUrl:    rm.SchemaUrl,
+				}
+			},
+			func(sm *metricspb.ScopeMetrics, metrics []*metricspb.Metric) *metricspb.ScopeMetrics {
+				return &metricspb.ScopeMetrics{
+					Scope:     sm.Scope,
+					Metrics:   metrics,
+					SchemaUrl: sm.SchemaUrl,
+				}
+			},
+			func(metric *metricspb.Metric) string {
+				tooLargeItems += otlpproto.MetricDataPoints(metric)
+				return fmt.Sprintf("metric %q", metric.Name)
+			},
+		)
+		for _, rm := range resources {
+			parts = append(parts, &collectormetrics.ExportMetricsServiceRequest{ResourceMetrics: rm})
+		}
+	case *collectorlogs.ExportLogsServiceRequest:
+		var resources [][]*logspb.ResourceLogs
+		resources, tooLarge = splitResources(req.ResourceLogs, maxBytes,
+			(*logspb.ResourceLogs).GetScopeLogs,
+			(*logspb.ScopeLogs).GetLogRecords,
+			func(rl *logspb.ResourceLogs, scopes []*logspb.ScopeLogs) *logspb.ResourceLogs {
+				return &logspb.ResourceLogs{
+					Resource:  rl.Resource,
+					ScopeLogs: scopes,
+					SchemaUrl: rl.SchemaUrl,
+				}
+			},
+			func(sl *logspb.ScopeLogs, records []*logspb.LogRecord) *logspb.ScopeLogs {
+				return &logspb.ScopeLogs{
+					Scope:      sl.Scope,
+					LogRecords: records,
+					SchemaUrl:  sl.SchemaUrl,
+				}
+			},
+			func(record *logspb.LogRecord) string {
+				tooLargeItems++
+				return fmt.Sprintf("log record %q", truncate(record.Body.GetStringValue(), 50))
+			},
+		)
+		for _, rl := range resources {
+			parts = append(parts, &collectorlogs.ExportLogsServiceRequest{ResourceLogs: rl})
+		}
+	default:
+		return nil
+	}
+
+	call := exportCallFromContext(ctx)
+	for _, item := range tooLarge {
+		internal.Logger.Printf("dropping %s: it is larger than the max payload size (%d bytes)",
+			item, maxBytes)
+	}
+	if call != nil {
+		call.tooLarge.Add(int64(tooLargeItems))
+		if len(parts) > 1 {
+			call.extraRequests.Add(int64(len(parts) - 1))
+		}
+	}
+
+	return parts
+}
+
+// splitResources greedily packs the items into parts no larger than maxBytes preserving
+// the resource and scope of each item. It also returns the descriptions of the items
+// that don't fit into a part on their own.
+func splitResources[R, S, I proto.Message](
+	resources []R,
+	maxBytes int,
+	scopes func(R) []S,
+	items func(S) []I,
+	newResource func(R, []S) R,
+	newScope func(S, []I) S,
+	describe func(I) string,
+) (parts [][]R, tooLarge []string) {
+	var part []R
+	var partSize int
+
+	for _, res := range resources {
+		resHeader := proto.Size(newResource(res, nil)) + fieldOverhead
+		var partScopes []S
+
+		for _, scope := range scopes(res) {
+			scopeHeader := proto.Size(newScope(scope, nil)) + fieldOverhead
+			var partItems []I
+
+			for _, item := range items(scope) {
+				itemSize := proto.Size(item) + fieldOverhead
+				if resHeader+scopeHeader+itemSize > maxBytes {
+					tooLarge = append(tooLarge, describe(item))
+					continue
+				}
+
+				need := itemSize
+				if len(partItems) == 0 {
+					need += scopeHeader
+					if len(partScopes) == 0 {
+						need += resHeader
+					}
+				}
+
+				if partSize+need > maxBytes {
+					if len(partItems) > 0 {
+						partScopes = append(partScopes, newScope(scope, partItems))
+					}
+					if len(partScopes) > 0 {
+						part = append(part, newResource(res, partScopes))
+					}
+					parts = append(parts, part)
+
+					part, partScopes, partItems, partSize = nil, nil, nil, 0
+					need = resHeader + scopeHeader + itemSize
+				}
+
+				partItems = append(partItems, item)
+				partSize += need
+			}
+
+			if len(partItems) > 0 {
+				partScopes = append(partScopes, newScope(scope, partItems))
+			}
+		}
+
+		if len(partScopes) > 0 {
+			part = append(part, newResource(res, partScopes))
+		}
+	}
+
+	if len(part) > 0 {
+		parts = append(parts, part)
+	}
+	return parts, tooLarge
+}
+
+// tooLargeError is returned when all items of the request are larger
+// than the max payload size.
+func (s *payloadSplitter) tooLargeError(signal Signal) error {
+	return &permanentError{fmt.Errorf(
+		"uptrace: dropped %s: all items are larger than the max payload size (%d bytes)",
+		signal, s.maxBytes[signal])}
+}
+
+// partError is returned when a part fails after other parts were accepted.
+// The error is permanent and does not wrap err so the exporter does not resend
+// the accepted parts.
+func (s *payloadSplitter) partError(failed, total int, err error) error {
+	return &permanentError{fmt.Errorf(
+		"uptrace: %d of %d parts of the split request were not accepted: %s",
+		failed, total, err)}
+}
+
+func (s *payloadSplitter) newBackoff() *partBackoff {
+	return &partBackoff{
+		conf:     s.retry,
+		interval: s.retry.InitialInterval,
+		start:    time.Now(),
+	}
+}
+
+// partBackoff is the exponential backoff used to retry a part of the split request.
+type partBackoff struct {
+	conf     RetryConfig
+	interval time.Duration
+	start    time.Time
+}
+
+// wait waits before the part is sent again. It returns false if the part
+// should not be retried because retrying is disabled, the retry budget is spent,
+// or the context is done before the next attempt.
+func (b *partBackoff) wait(ctx context.Context) bool {
+	if !b.conf.Enabled {
+		return false
+	}
+	if b.conf.MaxElapsedTime > 0 && time.Since(b.start)+b.interval > b.conf.MaxElapsedTime {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < b.interval {
+		return false
+	}
+
+	timer := time.NewTimer(b.interval)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return false
+	}
+
+	b.interval *= 2
+	if b.conf.MaxInterval > 0 {
+		b.interval = min(b.interval, b.conf.MaxInterval)
+	}
+	return true
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// signalFromPath returns the signal for the OTLP/HTTP path or the OTLP/gRPC method.
+func signalFromPath(path string) (Signal, bool) {
+	switch {
+	case strings.HasSuffix(path, "/v1/traces"), path == grpcTracesMethod:
+		return SignalTraces, true
+	case strings.HasSuffix(path, "/v1/metrics"), path == grpcMetricsMethod:
+		return SignalMetrics, true
+	case strings.HasSuffix(path, "/v1/logs"), path == grpcLogsMethod:
+		return SignalLogs, true
+	default:
+		return "", false
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// unaryClientInterceptor sends the parts of oversized OTLP/gRPC requests one by one.
+func (s *payloadSplitter) unaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req, reply any,
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	signal, ok := signalFromPath(method)
+	msg, isProto := req.(proto.Message)
+	if !ok || !isProto {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	parts := s.split(ctx, signal, msg)
+	if parts == nil {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	if len(parts) == 0 {
+		return s.tooLargeError(signal)
+	}
+
+	for i, part := range parts {
+		backoff := s.newBackoff()
+		for {
+			err := invoker(ctx, method, part, reply, cc, opts...)
+			if err == nil {
+				break
+			}
+			if i == 0 {
+				// Nothing was accepted yet so the exporter can safely retry the whole request.
+				return err
+			}
+			if !isTemporaryGRPCError(err) || !backoff.wait(ctx) {
+				return s.partError(len(parts)-i, len(parts), err)
+			}
+		}
+	}
+	return nil
+}
+
+// splitTransport sends the parts of oversized OTLP/HTTP requests one by one.
+type splitTransport struct {
+	splitter *payloadSplitter
+	next     http.RoundTripper
+}
+
+func (t *splitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	signal, ok := signalFromPath(req.URL.Path)
+	if !ok || t.splitter.maxBytes[signal] <= 0 ||
+		req.Header.Get("Content-Type") != "application/x-protobuf" {
+		return t.next.RoundTrip(req)
+	}
+
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	gzipped := req.Header.Get("Content-Encoding") == "gzip"
+
+	parts, err := t.splitBody(req.Context(), signal, body, gzipped)
+	if err != nil || parts == nil {
+		return t.send(req, body)
+	}
+	if len(parts) == 0 {
+		return nil, t.splitter.tooLargeError(signal)
+	}
+
+	var resp *http.Response
+	for i, part := range parts {
+		if resp != nil {
+			drainResponse(resp)
+		}
+
+		backoff := t.splitter.newBackoff()
+		for {
+			resp, err = t.send(req, part)
+			if err == nil && resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+				break
+			}
+			if i == 0 || errors.Is(err, ErrDSNRejected) {
+				// Nothing was accepted yet so the exporter can safely retry the whole request.
+				return resp, err
+			}
+
+			temporary := err != nil || isTemporaryHTTPStatus(resp.StatusCode)
+			if resp != nil {
+				err = fmt.Errorf("got %s", resp.Status)
+				drainResponse(resp)
+			}
+			if !temporary || !backoff.wait(req.Context()) {
+				return nil, t.splitter.partError(len(parts)-i, len(parts), err)
+			}
+		}
+	}
+	return resp, nil
+}
+
+func drainResponse(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+}
+
+// splitBody returns the encoded parts of the request body or nil
+// if the body does not need to be split.
+func (t *splitTransport) splitBody(
+	ctx context.Context, signal Signal, body []byte, gzipped bool,
+) ([][]byte, error) {
+	maxBytes := t.splitter.maxBytes[signal]
+	if gzipped {
+		// The gzip trailer contains the size of the uncompressed data.
+		if len(body) >= 4 && int64(binary.LittleEndian.Uint32(body[len(body)-4:])) <= int64(maxBytes) {
+			return nil, nil
+		}
+	} else if len(body) <= maxBytes {
+		return nil, nil
+	}
+
+	data := body
+	if gzipped {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	msg := otlpproto.NewExportRequest(string(signal))
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+
+	parts := t.splitter.split(ctx, signal, msg)
+	if parts == nil {
+		return nil, nil
+	}
+
+	encoded := make([][]byte, 0, len(parts))
+	for _, part := range parts {
+		b, err := proto.Marshal(part)
+		if err != nil {
+			return nil, err
+		}
+		if gzipped {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			_, _ = zw.Write(b)
+			if err := zw.Close(); err != nil {
+				return nil, err
+			}
+			b = buf.Bytes()
+		}
+		encoded = append(encoded, b)
+	}
+	return encoded, nil
+}
+
+func (t *splitTransport) send(req *http.Request, body []byte) (*http.Response, error) {
+	clone := req.Clone(req.Context())
+	clone.Body = io.NopCloser(bytes.NewReader(body))
+	clone.ContentLength = int64(len(body))
+	clone.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return t.next.RoundTrip(clone)
+}
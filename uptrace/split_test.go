@@ -0,0 +1,245 @@
+package uptrace
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPayloadSplitter(t *testing.T) {
+	newSpans := func(n int) []*tracepb.Span {
+		spans := make([]*tracepb.Span, n)
+		for i := range spans {
+			spans[i] = &tracepb.Span{Name: strings.Repeat("x", 100)}
+		}
+		return spans
+	}
+
+	req := &collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: &resourcepb.Resource{
+				Attributes: []*commonpb.KeyValue{{
+					Key:   "service.name",
+					Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "myservice"}},
+				}},
+			},
+			ScopeSpans: []*tracepb.ScopeSpans{
+				{Scope: &commonpb.InstrumentationScope{Name: "scope1"}, Spans: newSpans(20)},
+				{Scope: &commonpb.InstrumentationScope{Name: "scope2"}, Spans: newSpans(20)},
+			},
+		}},
+	}
+	req.ResourceSpans[0].ScopeSpans[1].Spans[5].Name = strings.Repeat("x", 2000)
+
+	splitter := &payloadSplitter{maxBytes: map[Signal]int{SignalTraces: 1000}}
+	require.Nil(t, splitter.split(context.Background(), SignalMetrics, req))
+
+	call := &exportCall{}
+	ctx := context.WithValue(context.Background(), exportCallKey{}, call)
+	parts := splitter.split(ctx, SignalTraces, req)
+	require.Greater(t, len(parts), 1)
+
+	var spans int
+	for _, part := range parts {
+		require.LessOrEqual(t, proto.Size(part), 1000)
+		for _, rs := range part.(*collectortrace.ExportTraceServiceRequest).ResourceSpans {
+			require.Equal(t, "service.name", rs.Resource.Attributes[0].Key)
+			for _, ss := range rs.ScopeSpans {
+				require.NotEmpty(t, ss.Scope.Name)
+				spans += len(ss.Spans)
+			}
+		}
+	}
+	require.Equal(t, 39, spans)
+	require.Equal(t, int64(1), call.tooLarge.Load())
+	require.Equal(t, int64(len(parts)-1), call.extraRequests.Load())
+}
+
+func TestMaxPayloadBytes(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var bodySizes []int
+	var spans int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		zr, err := gzip.NewReader(req.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(zr)
+		require.NoError(t, err)
+
+		msg := new(collectortrace.ExportTraceServiceRequest)
+		require.NoError(t, proto.Unmarshal(body, msg))
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		bodySizes = append(bodySizes, len(body))
+		for _, rs := range msg.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans += len(ss.Spans)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	client, err := New(ctx,
+		WithDSN("http://token@"+srv.Listener.Addr().String()+"/1"),
+		WithMaxPayloadBytes(SignalTraces, 4000),
+		WithMetricsDisabled(),
+		WithLoggingDisabled(),
+		WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	tracer := client.TracerProvider().Tracer("test")
+	for i := 0; i < 50; i++ {
+		_, span := tracer.Start(ctx, "hello")
+		span.SetAttributes(attribute.String("foo", strings.Repeat("x", 100)))
+		span.End()
+	}
+	_, span := tracer.Start(ctx, "too-large")
+	span.SetAttributes(attribute.String("foo", strings.Repeat("x", 5000)))
+	span.End()
+	require.NoError(t, client.ForceFlush(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Equal(t, 50, spans)
+	require.Greater(t, len(bodySizes), 1)
+	for _, size := range bodySizes {
+		require.LessOrEqual(t, size, 4000)
+	}
+
+	stats := client.Stats()[0]
+	require.Equal(t, int64(50), stats.Exported)
+	require.Equal(t, int64(1), stats.TooLarge)
+	require.Equal(t, int64(0), stats.Retried)
+}
+
+func TestMaxPayloadBytesRetryPart(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var requests, spans int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		zr, err := gzip.NewReader(req.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(zr)
+		require.NoError(t, err)
+
+		msg := new(collectortrace.ExportTraceServiceRequest)
+		require.NoError(t, proto.Unmarshal(body, msg))
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests++
+		if requests == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		for _, rs := range msg.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans += len(ss.Spans)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	client, err := New(ctx,
+		WithDSN("http://token@"+srv.Listener.Addr().String()+"/1"),
+		WithMaxPayloadBytes(SignalTraces, 4000),
+		WithRetry(RetryConfig{
+			Enabled:         true,
+			InitialInterval: time.Millisecond,
+			MaxInterval:     time.Millisecond,
+			MaxElapsedTime:  time.Second,
+		}),
+		WithMetricsDisabled(),
+		WithLoggingDisabled(),
+		WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	tracer := client.TracerProvider().Tracer("test")
+	for i := 0; i < 50; i++ {
+		_, span := tracer.Start(ctx, "hello")
+		span.SetAttributes(attribute.String("foo", strings.Repeat("x", 100)))
+		span.End()
+	}
+	require.NoError(t, client.ForceFlush(ctx))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Only the failed part is sent again.
+	require.Equal(t, 50, spans)
+
+	stats := client.Stats()[0]
+	require.Equal(t, int64(50), stats.Exported)
+	require.Equal(t, int64(1), stats.Retried)
+}
+
+func TestSplitTransportTooLarge(t *testing.T) {
+	var sent int
+	tr := &splitTransport{
+		splitter: &payloadSplitter{maxBytes: map[Signal]int{SignalTraces: 1000}},
+		next: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			sent++
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+	}
+
+	newRequest := func(msg proto.Message) *http.Request {
+		body, err := proto.Marshal(msg)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/v1/traces", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		return req
+	}
+
+	small := &collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{Name: "hello"}}}},
+		}},
+	}
+	resp, err := tr.RoundTrip(newRequest(small))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 1, sent)
+
+	large := &collectortrace.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{Name: strings.Repeat("x", 2000)}}}},
+		}},
+	}
+	_, err = tr.RoundTrip(newRequest(large))
+	require.Error(t, err)
+	var permanent *permanentError
+	require.ErrorAs(t, err, &permanent)
+	require.Equal(t, 1, sent)
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
@@ -0,0 +1,313 @@
+package uptrace
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"google.golang.org/grpc/stats"
+)
+
+// Signal is an OpenTelemetry signal.
+type Signal string
+
+const (
+	SignalTraces  Signal = "traces"
+	SignalMetrics Signal = "metrics"
+	SignalLogs    Signal = "logs"
+)
+
+// ExportStats is a snapshot of the export pipeline counters for a DSN and signal.
+// Items are spans, metric data points, or log records depending on the signal.
+type ExportStats struct {
+	// DSN is the redacted DSN or the `file://` URL of the directory
+	// used by the file exporter.
+	DSN    string
+	Signal Signal
+
+	// Exported is the number of items accepted by Uptrace.
+	Exported int64
+	// Failed is the number of items in the exports that failed.
+	Failed int64
+	// Dropped is the estimated number of items dropped by the batch processor
+	// because its queue was full.
+	Dropped int64
+	// TooLarge is the number of items dropped because they are larger
+	// than the max payload size.
+	TooLarge int64
+	// Retried is the number of retried export requests.
+	Retried int64
+	// Bytes is the number of payload bytes sent, including retries.
+	Bytes int64
+	// QueueSize is the estimated number of items waiting to be exported.
+	QueueSize int64
+
+	// Exports is the number of export calls.
+	Exports int64
+	// ExportDuration is the total duration of the export calls.
+	ExportDuration time.Duration
+}
+
+// exportStats collects the export pipeline counters for a DSN and signal.
+type exportStats struct {
+	dsn    string
+	signal Signal
+
+	exported  atomic.Int64
+	failed    atomic.Int64
+	dropped   atomic.Int64
+	tooLarge  atomic.Int64
+	retried   atomic.Int64
+	bytes     atomic.Int64
+	queueSize atomic.Int64
+
+	exports        atomic.Int64
+	exportDuration atomic.Int64
+
+	attrs    attribute.Set
+	duration atomic.Value // metric.Float64Histogram
+}
+
+// newExportStats creates stats for the redacted DSN or the file exporter URL.
+func newExportStats(dsn string, signal Signal) *exportStats {
+	return &exportStats{
+		dsn:    dsn,
+		signal: signal,
+		attrs: attribute.NewSet(
+			attribute.String("signal", string(signal)),
+			attribute.String("dsn", dsn),
+		),
+	}
+}
+
+func (s *exportStats) snapshot() ExportStats {
+	return ExportStats{
+		DSN:            s.dsn,
+		Signal:         s.signal,
+		Exported:       s.exported.Load(),
+		Failed:         s.failed.Load(),
+		Dropped:        s.dropped.Load(),
+		TooLarge:       s.tooLarge.Load(),
+		Retried:        s.retried.Load(),
+		Bytes:          s.bytes.Load(),
+		QueueSize:      s.queueSize.Load(),
+		Exports:        s.exports.Load(),
+		ExportDuration: time.Duration(s.exportDuration.Load()),
+	}
+}
+
+// enqueue counts n items passed to the batch processor with the queue limited by maxSize.
+// The batch processor drops the items when its queue is full so the items that don't fit
+// are counted as dropped instead of queued.
+func (s *exportStats) enqueue(n, maxSize int64) {
+	for {
+		size := s.queueSize.Load()
+		if size+n > maxSize {
+			s.dropped.Add(n)
+			return
+		}
+		if s.queueSize.CompareAndSwap(size, size+n) {
+			return
+		}
+	}
+}
+
+// dequeue is called when the batch processor passes n items to the exporter.
+// The queue size is an estimate so it never goes below zero.
+func (s *exportStats) dequeue(n int64) {
+	if s == nil {
+		return
+	}
+	for {
+		size := s.queueSize.Load()
+		if s.queueSize.CompareAndSwap(size, max(size-n, 0)) {
+			return
+		}
+	}
+}
+
+// export calls fn to export n items and records the outcome.
+func (s *exportStats) export(ctx context.Context, n int, fn func(ctx context.Context) error) error {
+	call := &exportCall{stats: s}
+	ctx = context.WithValue(ctx, exportCallKey{}, call)
+
+	start := time.Now()
+	err := fn(ctx)
+	dur := time.Since(start)
+
+	tooLarge := call.tooLarge.Load()
+	s.exports.Add(1)
+	s.exportDuration.Add(int64(dur))
+	s.tooLarge.Add(tooLarge)
+	if err != nil {
+		s.failed.Add(int64(n) - tooLarge)
+	} else {
+		s.exported.Add(int64(n) - tooLarge)
+	}
+	if retries := call.attempts.Load() - 1 - call.extraRequests.Load(); retries > 0 {
+		s.retried.Add(retries)
+	}
+
+	if hist, ok := s.duration.Load().(metric.Float64Histogram); ok {
+		opts := []metric.RecordOption{metric.WithAttributeSet(s.attrs)}
+		if err != nil {
+			opts = append(opts, metric.WithAttributes(attribute.String("error.type", "export_failed")))
+		}
+		hist.Record(ctx, dur.Seconds(), opts...)
+	}
+
+	return err
+}
+
+// exportCall is passed with the context to count export requests and payload bytes.
+type exportCall struct {
+	stats    *exportStats
+	attempts atomic.Int64
+	// extraRequests is the number of additional requests made by splitting the payload.
+	extraRequests atomic.Int64
+	tooLarge      atomic.Int64
+}
+
+type exportCallKey struct{}
+
+func exportCallFromContext(ctx context.Context) *exportCall {
+	call, _ := ctx.Value(exportCallKey{}).(*exportCall)
+	return call
+}
+
+//------------------------------------------------------------------------------
+
+// statsTransport counts OTLP/HTTP requests and payload bytes.
+type statsTransport struct {
+	next http.RoundTripper
+}
+
+func (t *statsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	call := exportCallFromContext(req.Context())
+	if call == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	call.attempts.Add(1)
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &countingReader{ReadCloser: req.Body, n: &call.stats.bytes}
+	}
+	return t.next.RoundTrip(req)
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// grpcStatsHandler counts OTLP/gRPC requests and payload bytes.
+type grpcStatsHandler struct{}
+
+var _ stats.Handler = (*grpcStatsHandler)(nil)
+
+func (h *grpcStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (h *grpcStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	call := exportCallFromContext(ctx)
+	if call == nil {
+		return
+	}
+
+	switch s := s.(type) {
+	case *stats.Begin:
+		call.attempts.Add(1)
+	case *stats.OutPayload:
+		call.stats.bytes.Add(int64(s.WireLength))
+	}
+}
+
+func (h *grpcStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *grpcStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+//------------------------------------------------------------------------------
+
+// Stats returns a snapshot of the export pipeline counters for each DSN and signal.
+func (c *Client) Stats() []ExportStats {
+	snapshot := make([]ExportStats, len(c.stats))
+	for i, s := range c.stats {
+		snapshot[i] = s.snapshot()
+	}
+	return snapshot
+}
+
+// instrumentStats publishes the export pipeline counters using the meter provider.
+func (c *Client) instrumentStats(provider *sdkmetric.MeterProvider) error {
+	meter := provider.Meter("github.com/uptrace/uptrace-go",
+		metric.WithInstrumentationVersion(Version()))
+
+	items, err := meter.Int64ObservableCounter("uptrace.exporter.items",
+		metric.WithDescription("Number of exported, failed, and dropped items"),
+		metric.WithUnit("{item}"))
+	if err != nil {
+		return err
+	}
+	retries, err := meter.Int64ObservableCounter("uptrace.exporter.retries",
+		metric.WithDescription("Number of retried export requests"),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return err
+	}
+	bytes, err := meter.Int64ObservableCounter("uptrace.exporter.bytes",
+		metric.WithDescription("Number of payload bytes sent"),
+		metric.WithUnit("By"))
+	if err != nil {
+		return err
+	}
+	queueSize, err := meter.Int64ObservableGauge("uptrace.exporter.queue.size",
+		metric.WithDescription("Number of items waiting to be exported"),
+		metric.WithUnit("{item}"))
+	if err != nil {
+		return err
+	}
+	duration, err := meter.Float64Histogram("uptrace.exporter.duration",
+		metric.WithDescription("Duration of export calls"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return err
+	}
+
+	for _, s := range c.stats {
+		s.duration.Store(duration)
+	}
+
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for _, s := range c.stats {
+			attrs := metric.WithAttributeSet(s.attrs)
+			outcome := func(outcome string) metric.ObserveOption {
+				return metric.WithAttributes(attribute.String("outcome", outcome))
+			}
+
+			o.ObserveInt64(items, s.exported.Load(), attrs, outcome("exported"))
+			o.ObserveInt64(items, s.failed.Load(), attrs, outcome("failed"))
+			o.ObserveInt64(items, s.dropped.Load(), attrs, outcome("dropped"))
+			o.ObserveInt64(items, s.tooLarge.Load(), attrs, outcome("too_large"))
+			o.ObserveInt64(retries, s.retried.Load(), attrs)
+			o.ObserveInt64(bytes, s.bytes.Load(), attrs)
+			o.ObserveInt64(queueSize, s.queueSize.Load(), attrs)
+		}
+		return nil
+	}, items, retries, bytes, queueSize)
+	return err
+}
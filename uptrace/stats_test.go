@@ -0,0 +1,59 @@
+package uptrace_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/uptrace/uptrace-go/uptrace"
+)
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+
+	var status atomic.Int64
+	status.Store(http.StatusOK)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.Copy(io.Discard, req.Body)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	client, err := uptrace.New(ctx,
+		uptrace.WithDSN("http://token@"+srv.Listener.Addr().String()+"/1"),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	tracer := client.TracerProvider().Tracer("test")
+	for i := 0; i < 3; i++ {
+		_, span := tracer.Start(ctx, "hello")
+		span.End()
+	}
+	require.NoError(t, client.ForceFlush(ctx))
+
+	status.Store(http.StatusBadRequest)
+	_, span := tracer.Start(ctx, "hello")
+	span.End()
+	require.Error(t, client.ForceFlush(ctx))
+
+	stats := client.Stats()
+	require.Len(t, stats, 1)
+
+	s := stats[0]
+	require.Equal(t, uptrace.SignalTraces, s.Signal)
+	require.Equal(t, "http://xxxxx@"+srv.Listener.Addr().String()+"/1", s.DSN)
+	require.Equal(t, int64(3), s.Exported)
+	require.Equal(t, int64(1), s.Failed)
+	require.Equal(t, int64(2), s.Exports)
+	require.Equal(t, int64(0), s.QueueSize)
+	require.Greater(t, s.Bytes, int64(0))
+}
@@ -0,0 +1,414 @@
+package uptrace
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TailSamplingOption configures a TailSamplingProcessor.
+type TailSamplingOption func(conf *tailSamplingConfig)
+
+type tailSamplingConfig struct {
+	decisionWait     time.Duration
+	latencyThreshold time.Duration
+	attributeRules   []attribute.KeyValue
+	spanFilters      []func(sdktrace.ReadOnlySpan) bool
+	ratio            float64
+	maxSpans         int
+	maxDecisions     int
+}
+
+// WithTailDecisionWait sets how long the spans of a trace are buffered, counting from
+// the first span, before the sampling decision is made. The default is 10 seconds.
+func WithTailDecisionWait(wait time.Duration) TailSamplingOption {
+	return func(conf *tailSamplingConfig) {
+		conf.decisionWait = wait
+	}
+}
+
+// WithTailLatencyThreshold keeps traces that contain a span longer than the threshold.
+func WithTailLatencyThreshold(threshold time.Duration) TailSamplingOption {
+	return func(conf *tailSamplingConfig) {
+		conf.latencyThreshold = threshold
+	}
+}
+
+// WithTailAttributeRule keeps traces that contain a span with any of the attributes,
+// for example, `attribute.Int("http.response.status_code", 429)`.
+func WithTailAttributeRule(attrs ...attribute.KeyValue) TailSamplingOption {
+	return func(conf *tailSamplingConfig) {
+		conf.attributeRules = append(conf.attributeRules, attrs...)
+	}
+}
+
+// WithTailSpanFilter keeps traces that contain a span for which the filter returns true.
+func WithTailSpanFilter(filter func(sdktrace.ReadOnlySpan) bool) TailSamplingOption {
+	return func(conf *tailSamplingConfig) {
+		conf.spanFilters = append(conf.spanFilters, filter)
+	}
+}
+
+// WithTailSamplingRatio sets the probability of keeping traces that don't match any rule.
+// The decision is derived from the trace ID. The default is 0.1.
+func WithTailSamplingRatio(ratio float64) TailSamplingOption {
+	return func(conf *tailSamplingConfig) {
+		conf.ratio = ratio
+	}
+}
+
+// WithTailMaxSpans limits the number of buffered spans. When the limit is reached,
+// the oldest traces are decided early using the spans received so far.
+// The default is 100000 spans.
+func WithTailMaxSpans(n int) TailSamplingOption {
+	return func(conf *tailSamplingConfig) {
+		conf.maxSpans = n
+	}
+}
+
+// WithTailMaxDecisions limits the number of remembered decisions that are used for
+// spans that end after the decision is made. When the limit is reached, the oldest
+// decisions are forgotten and their late spans are buffered as a new trace.
+// The default is 100000 decisions.
+func WithTailMaxDecisions(n int) TailSamplingOption {
+	return func(conf *tailSamplingConfig) {
+		conf.maxDecisions = n
+	}
+}
+
+//------------------------------------------------------------------------------
+
+// TailSamplingProcessor is a span processor that buffers the spans of each trace
+// and decides whether to keep the whole trace after the decision wait.
+//
+// It keeps traces that contain a span with an error status, a span longer than
+// the latency threshold, or a span matching an attribute rule or a span filter.
+// Other traces are sampled probabilistically using the trace ID. Spans that end after
+// the decision is made follow the decision.
+//
+// Register the processor with WithSpanProcessor. Uptrace exporters are then placed
+// behind the processor so only kept traces are exported. A span processor that wraps
+// the TailSamplingProcessor must implement `Unwrap() sdktrace.SpanProcessor` to be
+// detected:
+//
+//	uptrace.ConfigureOpentelemetry(
+//		uptrace.WithSpanProcessor(uptrace.NewTailSamplingProcessor(
+//			uptrace.WithTailLatencyThreshold(time.Second),
+//			uptrace.WithTailSamplingRatio(0.05),
+//		)),
+//	)
+//
+// Because the decision is made after the spans end, the trace sampler must keep
+// the spans that should be considered, which is the default.
+// Each service makes its own decision about its part of a distributed trace.
+//
+// The processor starts a goroutine when the first span is buffered so it must be
+// shut down, which the tracer provider does on Shutdown.
+type TailSamplingProcessor struct {
+	conf tailSamplingConfig
+
+	mu         sync.Mutex
+	next       []sdktrace.SpanProcessor
+	traces     map[trace.TraceID]*tailTrace
+	queue      *list.List // *tailTrace ordered by the first span time
+	numSpans   int
+	decisions  map[trace.TraceID]bool
+	decisionsQ []trace.TraceID
+	decisionsI int
+	started    bool
+	stopped    bool
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+type tailTrace struct {
+	id        trace.TraceID
+	firstSeen time.Time
+	spans     []sdktrace.ReadOnlySpan
+	keep      bool
+	elem      *list.Element
+}
+
+var _ sdktrace.SpanProcessor = (*TailSamplingProcessor)(nil)
+
+// NewTailSamplingProcessor returns a new tail-based sampling span processor.
+func NewTailSamplingProcessor(opts ...TailSamplingOption) *TailSamplingProcessor {
+	conf := tailSamplingConfig{
+		decisionWait: 10 * time.Second,
+		ratio:        0.1,
+		maxSpans:     100000,
+		maxDecisions: 100000,
+	}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	if conf.decisionWait <= 0 {
+		conf.decisionWait = 10 * time.Second
+	}
+	if conf.maxSpans <= 0 {
+		conf.maxSpans = 100000
+	}
+	if conf.maxDecisions <= 0 {
+		conf.maxDecisions = 100000
+	}
+
+	return &TailSamplingProcessor{
+		conf:      conf,
+		traces:    make(map[trace.TraceID]*tailTrace),
+		queue:     list.New(),
+		decisions: make(map[trace.TraceID]bool),
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}
+}
+
+// register adds a span processor that receives the spans of the kept traces.
+func (p *TailSamplingProcessor) register(sp sdktrace.SpanProcessor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.next = append(p.next, sp)
+}
+
+func (p *TailSamplingProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	for _, sp := range p.processors() {
+		sp.OnStart(ctx, s)
+	}
+}
+
+func (p *TailSamplingProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+
+	traceID := s.SpanContext().TraceID()
+
+	p.mu.Lock()
+
+	if keep, ok := p.decisions[traceID]; ok {
+		p.mu.Unlock()
+		if keep {
+			p.forward([]sdktrace.ReadOnlySpan{s})
+		}
+		return
+	}
+
+	if !p.started && !p.stopped {
+		// The goroutine is started lazily so an unused processor does not leak it.
+		p.started = true
+		go p.run()
+	}
+
+	t, ok := p.traces[traceID]
+	if !ok {
+		t = &tailTrace{
+			id:        traceID,
+			firstSeen: time.Now(),
+		}
+		t.elem = p.queue.PushBack(t)
+		p.traces[traceID] = t
+	}
+	t.spans = append(t.spans, s)
+	p.numSpans++
+	if !t.keep && p.shouldKeep(s) {
+		t.keep = true
+	}
+
+	var kept []sdktrace.ReadOnlySpan
+	for p.numSpans > p.conf.maxSpans {
+		kept = append(kept, p.decide(p.queue.Front().Value.(*tailTrace))...)
+	}
+
+	p.mu.Unlock()
+
+	p.forward(kept)
+}
+
+func (p *TailSamplingProcessor) shouldKeep(s sdktrace.ReadOnlySpan) bool {
+	if s.Status().Code == codes.Error {
+		return true
+	}
+	if p.conf.latencyThreshold > 0 && s.EndTime().Sub(s.StartTime()) >= p.conf.latencyThreshold {
+		return true
+	}
+	if len(p.conf.attributeRules) > 0 {
+		for _, kv := range s.Attributes() {
+			for _, rule := range p.conf.attributeRules {
+				if kv.Key == rule.Key && kv.Value == rule.Value {
+					return true
+				}
+			}
+		}
+	}
+	for _, filter := range p.conf.spanFilters {
+		if filter(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// decide removes the trace from the buffer and returns the spans to forward.
+// The caller must hold the lock.
+func (p *TailSamplingProcessor) decide(t *tailTrace) []sdktrace.ReadOnlySpan {
+	p.queue.Remove(t.elem)
+	delete(p.traces, t.id)
+	p.numSpans -= len(t.spans)
+
+	keep := t.keep || sampleTraceID(t.id, p.conf.ratio)
+	p.rememberDecision(t.id, keep)
+
+	if keep {
+		return t.spans
+	}
+	return nil
+}
+
+// rememberDecision remembers the decision so late spans can follow it.
+// The number of remembered decisions is bounded and the oldest are forgotten first.
+func (p *TailSamplingProcessor) rememberDecision(traceID trace.TraceID, keep bool) {
+	if len(p.decisionsQ) < p.conf.maxDecisions {
+		p.decisionsQ = append(p.decisionsQ, traceID)
+	} else {
+		delete(p.decisions, p.decisionsQ[p.decisionsI])
+		p.decisionsQ[p.decisionsI] = traceID
+		p.decisionsI = (p.decisionsI + 1) % len(p.decisionsQ)
+	}
+	p.decisions[traceID] = keep
+}
+
+// sampleTraceID makes a probabilistic decision using the random part of the trace ID
+// like sdktrace.TraceIDRatioBased.
+func sampleTraceID(traceID trace.TraceID, ratio float64) bool {
+	if ratio >= 1 {
+		return true
+	}
+	if ratio <= 0 {
+		return false
+	}
+	x := binary.BigEndian.Uint64(traceID[8:16]) >> 1
+	return x < uint64(ratio*(1<<63))
+}
+
+func (p *TailSamplingProcessor) run() {
+	defer close(p.doneCh)
+
+	interval := p.conf.decisionWait / 10
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	if interval > time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopCh:
+			return
+		case now := <-ticker.C:
+			p.decideExpired(now)
+		}
+	}
+}
+
+// decideExpired decides the traces buffered longer than the decision wait.
+func (p *TailSamplingProcessor) decideExpired(now time.Time) {
+	p.mu.Lock()
+
+	var kept []sdktrace.ReadOnlySpan
+	for e := p.queue.Front(); e != nil; e = p.queue.Front() {
+		t := e.Value.(*tailTrace)
+		if now.Sub(t.firstSeen) < p.conf.decisionWait {
+			break
+		}
+		kept = append(kept, p.decide(t)...)
+	}
+
+	p.mu.Unlock()
+
+	p.forward(kept)
+}
+
+// decideAll decides all buffered traces using the spans received so far.
+func (p *TailSamplingProcessor) decideAll() {
+	p.mu.Lock()
+
+	var kept []sdktrace.ReadOnlySpan
+	for e := p.queue.Front(); e != nil; e = p.queue.Front() {
+		kept = append(kept, p.decide(e.Value.(*tailTrace))...)
+	}
+
+	p.mu.Unlock()
+
+	p.forward(kept)
+}
+
+func (p *TailSamplingProcessor) forward(spans []sdktrace.ReadOnlySpan) {
+	if len(spans) == 0 {
+		return
+	}
+	processors := p.processors()
+	for _, s := range spans {
+		for _, sp := range processors {
+			sp.OnEnd(s)
+		}
+	}
+}
+
+func (p *TailSamplingProcessor) processors() []sdktrace.SpanProcessor {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.next
+}
+
+// ForceFlush decides all buffered traces without waiting and flushes
+// the registered span processors.
+func (p *TailSamplingProcessor) ForceFlush(ctx context.Context) error {
+	p.decideAll()
+
+	var errs []error
+	for _, sp := range p.processors() {
+		if err := sp.ForceFlush(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown decides all buffered traces and shuts down the registered span processors.
+func (p *TailSamplingProcessor) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	started, stopped := p.started, p.stopped
+	p.stopped = true
+	p.mu.Unlock()
+
+	if !stopped {
+		close(p.stopCh)
+	}
+	if started {
+		<-p.doneCh
+	}
+
+	p.decideAll()
+
+	var errs []error
+	for _, sp := range p.processors() {
+		if err := sp.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
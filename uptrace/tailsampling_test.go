@@ -0,0 +1,187 @@
+package uptrace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTailSamplingProcessor(t *testing.T) {
+	ctx := context.Background()
+
+	tail := NewTailSamplingProcessor(
+		WithTailDecisionWait(time.Hour),
+		WithTailLatencyThreshold(time.Second),
+		WithTailAttributeRule(attribute.Int("http.response.status_code", 429)),
+		WithTailSamplingRatio(0),
+	)
+	recorder := tracetest.NewSpanRecorder()
+	tail.register(recorder)
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(tail))
+	defer provider.Shutdown(ctx)
+	tracer := provider.Tracer("test")
+
+	newTrace := func(name string, fn func(span trace.Span)) {
+		ctx, root := tracer.Start(ctx, name)
+		_, child := tracer.Start(ctx, name+"-child")
+		fn(child)
+		child.End()
+		root.End()
+	}
+
+	newTrace("ok", func(span trace.Span) {})
+	newTrace("error", func(span trace.Span) {
+		span.SetStatus(codes.Error, "boom")
+	})
+	newTrace("slow", func(span trace.Span) {
+		span.End(trace.WithTimestamp(time.Now().Add(2 * time.Second)))
+	})
+	newTrace("attr", func(span trace.Span) {
+		span.SetAttributes(attribute.Int("http.response.status_code", 429))
+	})
+	require.Empty(t, recorder.Ended())
+
+	require.NoError(t, tail.ForceFlush(ctx))
+
+	var names []string
+	for _, s := range recorder.Ended() {
+		names = append(names, s.Name())
+	}
+	require.ElementsMatch(t, []string{
+		"error", "error-child",
+		"slow", "slow-child",
+		"attr", "attr-child",
+	}, names)
+}
+
+func TestTailSamplingLateSpans(t *testing.T) {
+	ctx := context.Background()
+
+	tail := NewTailSamplingProcessor(WithTailDecisionWait(time.Hour), WithTailSamplingRatio(0))
+	recorder := tracetest.NewSpanRecorder()
+	tail.register(recorder)
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(tail))
+	defer provider.Shutdown(ctx)
+	tracer := provider.Tracer("test")
+
+	ctx, root := tracer.Start(ctx, "root")
+	_, child := tracer.Start(ctx, "child")
+	child.SetStatus(codes.Error, "boom")
+	child.End()
+
+	require.NoError(t, tail.ForceFlush(ctx))
+	require.Len(t, recorder.Ended(), 1)
+
+	root.End()
+	require.Len(t, recorder.Ended(), 2)
+}
+
+func TestTailSamplingDecisionWait(t *testing.T) {
+	ctx := context.Background()
+
+	tail := NewTailSamplingProcessor(WithTailDecisionWait(50*time.Millisecond), WithTailSamplingRatio(1))
+	recorder := tracetest.NewSpanRecorder()
+	tail.register(recorder)
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(tail))
+	defer provider.Shutdown(ctx)
+
+	_, span := provider.Tracer("test").Start(ctx, "hello")
+	span.End()
+	require.Empty(t, recorder.Ended())
+
+	require.Eventually(t, func() bool {
+		return len(recorder.Ended()) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestTailSamplingMaxSpans(t *testing.T) {
+	ctx := context.Background()
+
+	tail := NewTailSamplingProcessor(
+		WithTailDecisionWait(time.Hour),
+		WithTailSamplingRatio(1),
+		WithTailMaxSpans(2),
+	)
+	recorder := tracetest.NewSpanRecorder()
+	tail.register(recorder)
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(tail))
+	defer provider.Shutdown(ctx)
+	tracer := provider.Tracer("test")
+
+	for i := 0; i < 3; i++ {
+		_, span := tracer.Start(ctx, "hello")
+		span.End()
+	}
+
+	require.Len(t, recorder.Ended(), 1)
+	require.Equal(t, 2, tail.numSpans)
+}
+
+func TestSampleTraceID(t *testing.T) {
+	var sampled int
+	gen := newIDGenerator()
+	for i := 0; i < 10000; i++ {
+		traceID, _ := gen.NewIDs(context.Background())
+		if sampleTraceID(traceID, 0.25) {
+			sampled++
+		}
+	}
+	require.InDelta(t, 2500, sampled, 300)
+}
+
+func TestTailSamplingLazyStart(t *testing.T) {
+	tail := NewTailSamplingProcessor()
+	require.False(t, tail.started)
+	require.NoError(t, tail.Shutdown(context.Background()))
+	require.NoError(t, tail.Shutdown(context.Background()))
+}
+
+func TestTailSamplingMaxDecisions(t *testing.T) {
+	ctx := context.Background()
+
+	tail := NewTailSamplingProcessor(
+		WithTailDecisionWait(time.Hour),
+		WithTailSamplingRatio(1),
+		WithTailMaxDecisions(2),
+	)
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(tail))
+	defer provider.Shutdown(ctx)
+	tracer := provider.Tracer("test")
+
+	for i := 0; i < 3; i++ {
+		_, span := tracer.Start(ctx, "hello")
+		span.End()
+		require.NoError(t, tail.ForceFlush(ctx))
+	}
+	require.Len(t, tail.decisions, 2)
+}
+
+type wrappedSpanProcessor struct {
+	sdktrace.SpanProcessor
+}
+
+func (p wrappedSpanProcessor) Unwrap() sdktrace.SpanProcessor {
+	return p.SpanProcessor
+}
+
+func TestTailSamplingProcessorUnwrap(t *testing.T) {
+	tail := NewTailSamplingProcessor()
+	defer tail.Shutdown(context.Background())
+
+	conf := &config{spanProcessors: []sdktrace.SpanProcessor{
+		tracetest.NewSpanRecorder(),
+		wrappedSpanProcessor{wrappedSpanProcessor{tail}},
+	}}
+	require.Same(t, tail, conf.tailSamplingProcessor())
+}
@@ -0,0 +1,202 @@
+package uptrace
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/uptrace/uptrace-go/internal"
+)
+
+type tlsFiles struct {
+	caFile   string
+	certFile string
+	keyFile  string
+}
+
+func (f *tlsFiles) empty() bool {
+	return f.caFile == "" && f.certFile == "" && f.keyFile == ""
+}
+
+// withDSN returns the files overridden by the DSN query params.
+func (f tlsFiles) withDSN(dsn *DSN) tlsFiles {
+	if dsn.CAFile != "" {
+		f.caFile = dsn.CAFile
+	}
+	if dsn.CertFile != "" {
+		f.certFile = dsn.CertFile
+	}
+	if dsn.KeyFile != "" {
+		f.keyFile = dsn.KeyFile
+	}
+	return f
+}
+
+// tlsServerName returns the host name used to verify the server certificate:
+// the ServerName of the configured TLS config or the DSN host.
+func tlsServerName(tlsConf *tls.Config, dsn *DSN) string {
+	if tlsConf != nil && tlsConf.ServerName != "" {
+		return tlsConf.ServerName
+	}
+	host, _, err := net.SplitHostPort(dsn.OTLPHttpEndpoint())
+	if err != nil {
+		return dsn.Host
+	}
+	return host
+}
+
+// newTLSConfig creates a TLS config using the CA bundle and the client certificate
+// stored in PEM files. The files are reloaded when they change on disk.
+// The server certificate is verified against the serverName.
+func newTLSConfig(files *tlsFiles, serverName string) (*tls.Config, error) {
+	if (files.certFile != "") != (files.keyFile != "") {
+		return nil, errors.New("both TLS certificate and key files are required")
+	}
+	if serverName == "" {
+		return nil, errors.New("TLS server name is required")
+	}
+
+	r := &tlsReloader{files: *files, serverName: serverName}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	tlsConf := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if files.caFile != "" {
+		// The default verification can't use a reloaded CA pool so the server
+		// certificate is verified in VerifyConnection instead.
+		tlsConf.InsecureSkipVerify = true
+		tlsConf.VerifyConnection = r.verifyConnection
+	}
+	if files.certFile != "" {
+		tlsConf.GetClientCertificate = r.getClientCertificate
+	}
+
+	return tlsConf, nil
+}
+
+// tlsReloader reloads the CA bundle and the client certificate when
+// the files change. Changes are checked on each TLS handshake.
+type tlsReloader struct {
+	files      tlsFiles
+	serverName string
+
+	mu     sync.Mutex
+	stamps [3]fileStamp
+	pool   *x509.CertPool
+	cert   *tls.Certificate
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func (r *tlsReloader) fileStamps() [3]fileStamp {
+	var stamps [3]fileStamp
+	for i, file := range []string{r.files.caFile, r.files.certFile, r.files.keyFile} {
+		if file == "" {
+			continue
+		}
+		if fi, err := os.Stat(file); err == nil {
+			stamps[i] = fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+		}
+	}
+	return stamps
+}
+
+// load loads the files. The caller must hold the lock or own the reloader.
+func (r *tlsReloader) load() error {
+	stamps := r.fileStamps()
+
+	var pool *x509.CertPool
+	if r.files.caFile != "" {
+		var err error
+		pool, err = loadCertPool(r.files.caFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	var cert *tls.Certificate
+	if r.files.certFile != "" {
+		c, err := tls.LoadX509KeyPair(r.files.certFile, r.files.keyFile)
+		if err != nil {
+			return fmt.Errorf("can't load TLS certificate: %w", err)
+		}
+		cert = &c
+	}
+
+	r.stamps = stamps
+	r.pool = pool
+	r.cert = cert
+	return nil
+}
+
+// reload reloads the files if they changed. On errors, for example, when
+// the files are partially written, it keeps using the previous files.
+func (r *tlsReloader) reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.fileStamps() == r.stamps {
+		return
+	}
+	if err := r.load(); err != nil {
+		internal.Logger.Printf("can't reload TLS files: %s", err)
+	}
+}
+
+func (r *tlsReloader) verifyConnection(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server did not provide a certificate")
+	}
+
+	r.reload()
+	r.mu.Lock()
+	pool := r.pool
+	r.mu.Unlock()
+
+	opts := x509.VerifyOptions{
+		// cs.ServerName is empty for IP addresses which would disable
+		// the host name check.
+		DNSName:       r.serverName,
+		Roots:         pool,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+func (r *tlsReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.reload()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cert, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("can't read CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("CA file %q does not contain PEM certificates", caFile)
+	}
+	return pool, nil
+}
@@ -0,0 +1,210 @@
+package uptrace
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSFilesReload(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	ca, caKey := newTestCert(t, "ca", nil, nil)
+	serverCert, serverKey := newTestCert(t, "server", ca, caKey)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeTestCert(t, caFile, "", ca, nil)
+
+	writeClientCert := func(name string, modTime time.Time) {
+		cert, key := newTestCert(t, name, ca, caKey)
+		writeTestCert(t, certFile, keyFile, cert, key)
+		require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+		require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+	}
+	writeClientCert("client1", time.Now().Add(-time.Hour))
+
+	var mu sync.Mutex
+	var clients []string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		clients = append(clients, req.TLS.PeerCertificates[0].Subject.CommonName)
+		mu.Unlock()
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	query := url.Values{"ca": {caFile}, "cert": {certFile}, "key": {keyFile}}
+	client, err := New(ctx,
+		WithDSN("https://token@"+srv.Listener.Addr().String()+"/1?"+query.Encode()),
+		WithMetricsDisabled(),
+		WithLoggingDisabled(),
+		WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	export := func() {
+		_, span := client.TracerProvider().Tracer("test").Start(ctx, "hello")
+		span.End()
+		require.NoError(t, client.ForceFlush(ctx))
+	}
+
+	export()
+
+	writeClientCert("client2", time.Now())
+	client.transports[0].baseTransport.(*http.Transport).CloseIdleConnections()
+	export()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []string{"client1", "client2"}, clients)
+}
+
+func TestTLSFilesUnknownCA(t *testing.T) {
+	ca, _ := newTestCert(t, "ca", nil, nil)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeTestCert(t, caFile, "", ca, nil)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer srv.Close()
+
+	tlsConf, err := newTLSConfig(&tlsFiles{caFile: caFile}, "127.0.0.1")
+	require.NoError(t, err)
+
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConf}}
+	_, err = httpClient.Get(srv.URL)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "certificate signed by unknown authority")
+}
+
+func TestTLSFilesIPHostMismatch(t *testing.T) {
+	ca, caKey := newTestCert(t, "ca", nil, nil)
+	serverCert, serverKey := newTestCertFor(t, "server", []string{"other.local"}, ca, caKey)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeTestCert(t, caFile, "", ca, nil)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dsn, err := ParseDSN("https://token@" + srv.Listener.Addr().String() + "/1")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", tlsServerName(nil, dsn))
+
+	tlsConf, err := newTLSConfig(&tlsFiles{caFile: caFile}, tlsServerName(nil, dsn))
+	require.NoError(t, err)
+
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConf}}
+	_, err = httpClient.Get(srv.URL)
+	require.Error(t, err)
+	var hostErr x509.HostnameError
+	require.ErrorAs(t, err, &hostErr)
+	require.Equal(t, "127.0.0.1", hostErr.Host)
+}
+
+func newTestCert(
+	t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey,
+) (*x509.Certificate, *ecdsa.PrivateKey) {
+	return newTestCertFor(t, name, []string{"127.0.0.1"}, parent, parentKey)
+}
+
+func newTestCertFor(
+	t *testing.T, name string, hosts []string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey,
+) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func writeTestCert(t *testing.T, certFile, keyFile string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	require.NoError(t, os.WriteFile(certFile, b, 0o600))
+
+	if keyFile != "" {
+		der, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err)
+		b := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		require.NoError(t, os.WriteFile(keyFile, b, 0o600))
+	}
+}
+
+func TestTLSFilesEnv(t *testing.T) {
+	ca, _ := newTestCert(t, "ca", nil, nil)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeTestCert(t, caFile, "", ca, nil)
+
+	t.Setenv("OTEL_EXPORTER_OTLP_CERTIFICATE", "/does/not/exist.pem")
+	t.Setenv("UPTRACE_CA_FILE", caFile)
+
+	conf, err := newConfig(nil)
+	require.NoError(t, err)
+	require.Equal(t, tlsFiles{caFile: caFile}, conf.tlsFiles)
+
+	dsn, err := ParseDSN("https://token@uptrace.local/1?ca=/etc/ca.pem&cert=/etc/cert.pem&key=/etc/key.pem")
+	require.NoError(t, err)
+	require.Equal(t, tlsFiles{
+		caFile:   "/etc/ca.pem",
+		certFile: "/etc/cert.pem",
+		keyFile:  "/etc/key.pem",
+	}, conf.tlsFiles.withDSN(dsn))
+}
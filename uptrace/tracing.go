@@ -2,63 +2,116 @@ package uptrace
 
 import (
 	"context"
-	cryptorand "crypto/rand"
 	"encoding/binary"
+	"fmt"
 	"log/slog"
-	"math/rand"
+	"math/rand/v2"
+	"net/url"
 	"runtime"
-	"sync"
 	"time"
 
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
-func configureTracing(ctx context.Context, conf *config) *sdktrace.TracerProvider {
+func configureTracing(ctx context.Context, conf *config) (*sdktrace.TracerProvider, error) {
 	provider := conf.tracerProvider
 	if provider == nil {
 		var opts []sdktrace.TracerProviderOption
 
-		opts = append(opts, sdktrace.WithIDGenerator(newIDGenerator()))
-		if res := conf.newResource(); res != nil {
+		idGenerator := conf.idGenerator
+		if idGenerator == nil {
+			idGenerator = newIDGenerator()
+		}
+		opts = append(opts, sdktrace.WithIDGenerator(idGenerator))
+		res := conf.newResource()
+		if res != nil {
 			opts = append(opts, sdktrace.WithResource(res))
 		}
-		if conf.traceSampler != nil {
+		if conf.remoteSamplerURL != "" {
+			conf.remoteSampler = newConfigRemoteSampler(conf, res)
+			opts = append(opts, sdktrace.WithSampler(sdktrace.ParentBased(conf.remoteSampler)))
+		} else if conf.traceSampler != nil {
 			opts = append(opts, sdktrace.WithSampler(conf.traceSampler))
 		}
 
 		provider = sdktrace.NewTracerProvider(opts...)
-		otel.SetTracerProvider(provider)
 	}
 
-	for _, dsn := range conf.dsn {
-		dsn, err := ParseDSN(dsn)
+	tail := conf.tailSamplingProcessor()
+
+	exporters := make([]sdktrace.SpanExporter, len(conf.transports))
+	for i, t := range conf.transports {
+		exp, err := otlptrace.New(ctx, otlpTraceClient(conf, t))
 		if err != nil {
-			slog.Error("ParseDSN failed", slog.Any("err", err))
-			continue
+			return nil, fmt.Errorf("otlptrace.New failed: %w", err)
 		}
+		exporters[i] = exp
+	}
 
-		exp, err := otlptrace.New(ctx, otlpTraceClient(conf, dsn))
-		if err != nil {
-			slog.Error("otlptrace.New failed", slog.Any("err", err))
-			continue
+	bspOptions := []sdktrace.BatchSpanProcessorOption{
+		sdktrace.WithMaxQueueSize(conf.spanBatch.maxQueueSize),
+		sdktrace.WithMaxExportBatchSize(conf.spanBatch.maxExportBatchSize),
+		sdktrace.WithBatchTimeout(conf.spanBatch.scheduleDelay),
+		sdktrace.WithExportTimeout(conf.spanBatch.exportTimeout),
+	}
+	bspOptions = append(bspOptions, conf.bspOptions...)
+
+	register := func(exp sdktrace.SpanExporter, queue *exportStats) {
+		sp := &queuedSpanProcessor{
+			SpanProcessor: sdktrace.NewBatchSpanProcessor(exp, bspOptions...),
+			stats:         queue,
+			maxQueueSize:  int64(maxQueueSize(bspOptions)),
+		}
+		if tail != nil {
+			tail.register(sp)
+		} else {
+			provider.RegisterSpanProcessor(sp)
 		}
+	}
 
-		queueSize := queueSize()
-		bspOptions := []sdktrace.BatchSpanProcessorOption{
-			sdktrace.WithMaxQueueSize(queueSize),
-			sdktrace.WithMaxExportBatchSize(queueSize),
-			sdktrace.WithBatchTimeout(10 * time.Second),
-			sdktrace.WithExportTimeout(10 * time.Second),
+	if conf.failover != nil {
+		// In the failover mode, the queue size is reported for the first DSN.
+		queue := conf.transports[0].signalStats(SignalTraces)
+		for i, t := range conf.transports {
+			exporters[i] = &spanExporter{
+				SpanExporter: exporters[i],
+				stats:        t.signalStats(SignalTraces),
+			}
 		}
-		bspOptions = append(bspOptions, conf.bspOptions...)
+		register(&failoverSpanExporter{
+			failover:  conf.failover,
+			exporters: exporters,
+			queue:     queue,
+		}, queue)
+	} else {
+		for i, t := range conf.transports {
+			stats := t.signalStats(SignalTraces)
+			register(&spanExporter{
+				SpanExporter: exporters[i],
+				stats:        stats,
+				queue:        stats,
+			}, stats)
+		}
+	}
 
-		bsp := sdktrace.NewBatchSpanProcessor(exp, bspOptions...)
-		provider.RegisterSpanProcessor(bsp)
+	if conf.fileExporter != nil {
+		exp, err := conf.fileExporter.spanExporter(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("otlptrace.New failed: %w", err)
+		}
+		stats := conf.fileExporter.signalStats(SignalTraces)
+		register(&spanExporter{
+			SpanExporter: exp,
+			stats:        stats,
+			queue:        stats,
+		}, stats)
 	}
 
 	// Register additional span processors.
@@ -75,27 +128,98 @@ func configureTracing(ctx context.Context, conf *config) *sdktrace.TracerProvide
 		}
 	}
 
-	return provider
+	return provider, nil
 }
 
-func otlpTraceClient(conf *config, dsn *DSN) otlptrace.Client {
+func newConfigRemoteSampler(conf *config, res *resource.Resource) *RemoteSampler {
+	samplerURL := conf.remoteSamplerURL
+	if u, err := url.Parse(samplerURL); err == nil && !u.Query().Has("service") && res != nil {
+		if service, ok := res.Set().Value(semconv.ServiceNameKey); ok {
+			query := u.Query()
+			query.Set("service", service.AsString())
+			u.RawQuery = query.Encode()
+			samplerURL = u.String()
+		}
+	}
+
+	var opts []RemoteSamplerOption
+	if conf.traceSampler != nil {
+		opts = append(opts, WithRemoteSamplerFallback(conf.traceSampler))
+	}
+	opts = append(opts, conf.remoteSamplerOpts...)
+	return NewRemoteSampler(samplerURL, opts...)
+}
+
+func otlpTraceClient(conf *config, t *transport) otlptrace.Client {
+	if t.protocol == ProtocolGRPC {
+		options := []otlptracegrpc.Option{
+			otlptracegrpc.WithGRPCConn(t.grpcConn),
+			otlptracegrpc.WithHeaders(conf.otlpHeaders(t.dsn)),
+			otlptracegrpc.WithTimeout(conf.otlpTimeout()),
+		}
+		if conf.retry != nil {
+			options = append(options, otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig(*conf.retry)))
+		}
+		return otlptracegrpc.NewClient(options...)
+	}
+
 	options := []otlptracehttp.Option{
-		otlptracehttp.WithEndpoint(dsn.OTLPHttpEndpoint()),
-		otlptracehttp.WithHeaders(map[string]string{
-			"uptrace-dsn": dsn.String(),
-		}),
+		otlptracehttp.WithEndpoint(t.dsn.OTLPHttpEndpoint()),
+		otlptracehttp.WithURLPath(t.dsn.OTLPHttpPath("/v1/traces")),
+		otlptracehttp.WithHTTPClient(t.httpClient),
+		otlptracehttp.WithHeaders(conf.otlpHeaders(t.dsn)),
 		otlptracehttp.WithCompression(otlptracehttp.GzipCompression),
 	}
-
-	if conf.tlsConf != nil {
-		options = append(options, otlptracehttp.WithTLSClientConfig(conf.tlsConf))
-	} else if dsn.Scheme == "http" {
+	if t.dsn.Scheme == "http" {
 		options = append(options, otlptracehttp.WithInsecure())
 	}
-
+	if conf.retry != nil {
+		options = append(options, otlptracehttp.WithRetry(otlptracehttp.RetryConfig(*conf.retry)))
+	}
 	return otlptracehttp.NewClient(options...)
 }
 
+// maxQueueSize returns the queue size configured by the batch span processor options.
+func maxQueueSize(opts []sdktrace.BatchSpanProcessorOption) int {
+	o := sdktrace.BatchSpanProcessorOptions{
+		MaxQueueSize: sdktrace.DefaultMaxQueueSize,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o.MaxQueueSize
+}
+
+// spanExporter records export stats. Exported spans are removed from the queue
+// stats unless the queue is nil.
+type spanExporter struct {
+	sdktrace.SpanExporter
+	stats *exportStats
+	queue *exportStats
+}
+
+func (e *spanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.queue.dequeue(int64(len(spans)))
+	return e.stats.export(ctx, len(spans), func(ctx context.Context) error {
+		return e.SpanExporter.ExportSpans(ctx, spans)
+	})
+}
+
+// queuedSpanProcessor tracks the number of spans queued by the batch span processor.
+// The batch span processor decides whether to drop spans when its queue is full.
+type queuedSpanProcessor struct {
+	sdktrace.SpanProcessor
+	stats        *exportStats
+	maxQueueSize int64
+}
+
+func (p *queuedSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if s.SpanContext().IsSampled() {
+		p.stats.enqueue(1, p.maxQueueSize)
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
 func queueSize() int {
 	const min = 1000
 	const max = 16000
@@ -112,19 +236,25 @@ func queueSize() int {
 
 //------------------------------------------------------------------------------
 
+// spanIDPrec is the precision of the timestamp in the first 4 bytes of span IDs.
 const spanIDPrec = int64(time.Millisecond)
 
-type idGenerator struct {
-	sync.Mutex
-	randSource *rand.Rand
+// NewTimeOrderedIDGenerator returns the default ID generator that generates time-ordered
+// trace and span IDs. Use TraceIDTime and SpanIDTime to decode the time from the IDs.
+func NewTimeOrderedIDGenerator() sdktrace.IDGenerator {
+	return newIDGenerator()
 }
 
+// idGenerator generates time-ordered IDs: trace IDs start with the 8-byte Unix time
+// in nanoseconds and span IDs start with the 4-byte Unix time in spanIDPrec units.
+// The rest of the bytes are random.
+//
+// The random bytes come from the per-thread ChaCha8 generators used by math/rand/v2
+// so generating IDs does not lock or allocate.
+type idGenerator struct{}
+
 func newIDGenerator() *idGenerator {
-	gen := &idGenerator{}
-	var rngSeed int64
-	_ = binary.Read(cryptorand.Reader, binary.LittleEndian, &rngSeed)
-	gen.randSource = rand.New(rand.NewSource(rngSeed))
-	return gen
+	return &idGenerator{}
 }
 
 var _ sdktrace.IDGenerator = (*idGenerator)(nil)
@@ -133,30 +263,78 @@ var _ sdktrace.IDGenerator = (*idGenerator)(nil)
 func (gen *idGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
 	unixNano := time.Now().UnixNano()
 
-	gen.Lock()
-	defer gen.Unlock()
-
 	tid := trace.TraceID{}
 	binary.BigEndian.PutUint64(tid[:8], uint64(unixNano))
-	_, _ = gen.randSource.Read(tid[8:])
-
-	sid := trace.SpanID{}
-	binary.BigEndian.PutUint32(sid[:4], uint32(unixNano/spanIDPrec))
-	_, _ = gen.randSource.Read(sid[4:])
+	binary.BigEndian.PutUint64(tid[8:], rand.Uint64())
 
-	return tid, sid
+	return tid, newSpanID(unixNano)
 }
 
 // NewSpanID returns a ID for a new span in the trace with traceID.
 func (gen *idGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
-	unixNano := time.Now().UnixNano()
-
-	gen.Lock()
-	defer gen.Unlock()
+	return newSpanID(time.Now().UnixNano())
+}
 
+func newSpanID(unixNano int64) trace.SpanID {
 	sid := trace.SpanID{}
 	binary.BigEndian.PutUint32(sid[:4], uint32(unixNano/spanIDPrec))
-	_, _ = gen.randSource.Read(sid[4:])
+	binary.BigEndian.PutUint32(sid[4:], rand.Uint32())
+	return sid
+}
+
+// TraceIDTime returns the time encoded in the first 8 bytes of a trace ID
+// generated by the time-ordered ID generator. The result is meaningless for
+// trace IDs generated by other generators.
+func TraceIDTime(traceID trace.TraceID) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(traceID[:8])))
+}
+
+// SpanIDMillis returns the millisecond counter encoded in the first 4 bytes of a span ID
+// generated by the time-ordered ID generator. The counter is the Unix time in milliseconds
+// modulo 2^32 so it wraps around every 49.7 days.
+func SpanIDMillis(spanID trace.SpanID) uint32 {
+	return binary.BigEndian.Uint32(spanID[:4])
+}
+
+// SpanIDTime returns the time encoded in a span ID generated by the time-ordered ID generator.
+// Because the millisecond counter wraps around, the result is the time closest to ref,
+// for example, the time returned by TraceIDTime for the span's trace ID.
+func SpanIDTime(spanID trace.SpanID, ref time.Time) time.Time {
+	refCounter := ref.UnixNano() / spanIDPrec
+	counter := refCounter + int64(int32(SpanIDMillis(spanID)-uint32(refCounter)))
+	return time.Unix(0, counter*spanIDPrec)
+}
+
+//------------------------------------------------------------------------------
+
+// NewRandomIDGenerator returns an ID generator that generates random trace and span IDs
+// as recommended by the W3C Trace Context specification. Unlike the time-ordered
+// ID generator, it does not leak the span start time.
+func NewRandomIDGenerator() sdktrace.IDGenerator {
+	return randomIDGenerator{}
+}
+
+type randomIDGenerator struct{}
+
+var _ sdktrace.IDGenerator = randomIDGenerator{}
 
+func (randomIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	tid := trace.TraceID{}
+	for !tid.IsValid() {
+		binary.BigEndian.PutUint64(tid[:8], rand.Uint64())
+		binary.BigEndian.PutUint64(tid[8:], rand.Uint64())
+	}
+	return tid, randomSpanID()
+}
+
+func (randomIDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	return randomSpanID()
+}
+
+func randomSpanID() trace.SpanID {
+	sid := trace.SpanID{}
+	for !sid.IsValid() {
+		binary.BigEndian.PutUint64(sid[:], rand.Uint64())
+	}
 	return sid
 }
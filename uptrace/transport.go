@@ -0,0 +1,277 @@
+package uptrace
+
+import (
+	"context"
+	"crypto/tls"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+)
+
+// transport holds the HTTP client or the gRPC connection shared by
+// the trace, metric, and log exporters of a DSN.
+type transport struct {
+	dsn      *DSN
+	protocol Protocol
+	headers  map[string]string
+	timeout  time.Duration
+	tlsConf  *tls.Config
+	// dsnFile reloads the DSN when the token is rotated.
+	dsnFile *dsnFile
+
+	httpClient *http.Client
+	grpcConn   *grpc.ClientConn
+
+	// baseTransport is the RoundTripper that sends OTLP/HTTP requests over the network.
+	baseTransport http.RoundTripper
+	// probeTransport sends OTLP/HTTP requests bypassing the stats and the disk queue.
+	probeTransport http.RoundTripper
+
+	breaker *breaker
+	queue   *diskQueue
+	stats   []*exportStats
+}
+
+func newTransport(conf *config, dsn *DSN) (*transport, error) {
+	t := &transport{
+		dsn:      dsn,
+		protocol: conf.dsnProtocol(dsn),
+		headers:  conf.otlpHeaders(dsn),
+		timeout:  conf.otlpTimeout(),
+		breaker:  newBreaker(dsn, conf.errorHandler),
+		tlsConf:  conf.tlsConf,
+		dsnFile:  conf.dsnFile,
+	}
+	if t.dsnFile != nil {
+		// Resume exporting when the rejected token is rotated.
+		t.breaker.reload = t.dsnFile.reload
+		t.dsnFile.subscribe(t.breaker.reset)
+	}
+
+	// The TLS config is created for each DSN to verify the server certificate
+	// against the DSN host.
+	files := conf.tlsFiles.withDSN(dsn)
+	if !files.empty() && (conf.tlsConf == nil || files != conf.tlsFiles) {
+		tlsConf, err := newTLSConfig(&files, tlsServerName(conf.tlsConf, dsn))
+		if err != nil {
+			return nil, err
+		}
+		t.tlsConf = tlsConf
+	}
+
+	if conf.diskQueueDir != "" {
+		dir := filepath.Join(conf.diskQueueDir, diskQueueName(dsn))
+		queue, err := newDiskQueue(dir, conf.diskQueueMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		queue.headers = t.queueHeaders
+		t.queue = queue
+	}
+
+	switch t.protocol {
+	case ProtocolGRPC:
+		conn, err := t.newGRPCConn(conf)
+		if err != nil {
+			_ = t.Close()
+			return nil, err
+		}
+		t.grpcConn = conn
+	default:
+		t.httpClient = t.newHTTPClient(conf)
+	}
+
+	if t.queue != nil {
+		t.queue.start()
+	}
+
+	return t, nil
+}
+
+func (t *transport) newHTTPClient(conf *config) *http.Client {
+	base := conf.roundTripper
+	if base == nil {
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		if t.tlsConf != nil {
+			tr.TLSClientConfig = t.tlsConf
+		}
+		if conf.proxyURL != nil {
+			tr.Proxy = http.ProxyURL(conf.proxyURL)
+		}
+		base = tr
+	}
+	t.baseTransport = base
+
+	if conf.headersFunc != nil {
+		base = &headersTransport{headers: conf.headersFunc, next: base}
+	}
+	if t.dsnFile != nil {
+		base = &headersTransport{headers: t.dsnFile.headers, next: base}
+	}
+	t.probeTransport = &breakerTransport{breaker: t.breaker, next: base}
+
+	var rt http.RoundTripper = &statsTransport{next: base}
+	rt = &breakerTransport{breaker: t.breaker, next: rt}
+	if len(conf.maxPayloadBytes) > 0 {
+		rt = &splitTransport{
+			splitter: newPayloadSplitter(conf),
+			next:     rt,
+		}
+	}
+	if t.queue != nil {
+		rt = newDiskQueueTransport(t.queue, rt)
+	}
+
+	return &http.Client{
+		Transport: rt,
+		Timeout:   conf.otlpTimeout(),
+	}
+}
+
+func (t *transport) newGRPCConn(conf *config) (*grpc.ClientConn, error) {
+	var creds credentials.TransportCredentials
+	switch {
+	case t.tlsConf != nil:
+		creds = credentials.NewTLS(t.tlsConf)
+	case t.dsn.Scheme == "http":
+		creds = insecure.NewCredentials()
+	default:
+		creds = credentials.NewTLS(nil)
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)),
+		grpc.WithUserAgent("uptrace-go/" + Version()),
+		grpc.WithStatsHandler(new(grpcStatsHandler)),
+	}
+	if conf.proxyURL != nil {
+		opts = append(opts,
+			grpc.WithContextDialer(proxyDialer(conf.proxyURL)),
+			grpc.WithNoProxy(),
+		)
+	}
+
+	var interceptors []grpc.UnaryClientInterceptor
+	if t.queue != nil {
+		interceptors = append(interceptors, t.queue.unaryClientInterceptor)
+	}
+	if len(conf.maxPayloadBytes) > 0 {
+		splitter := newPayloadSplitter(conf)
+		interceptors = append(interceptors, splitter.unaryClientInterceptor)
+	}
+	interceptors = append(interceptors, t.breaker.unaryClientInterceptor)
+	if conf.headersFunc != nil {
+		interceptors = append(interceptors, headersInterceptor(conf.headersFunc))
+	}
+	if t.dsnFile != nil {
+		interceptors = append(interceptors, headersInterceptor(t.dsnFile.headers))
+	}
+	opts = append(opts, grpc.WithChainUnaryInterceptor(interceptors...))
+
+	conn, err := grpc.NewClient(t.dsn.OTLPGrpcEndpoint(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.queue != nil {
+		t.queue.grpcConn = conn
+	}
+	return conn, nil
+}
+
+// queueHeaders returns the headers added by the exporters, that is, the headers
+// configured with WithHeaders and the uptrace-dsn header with the current DSN.
+func (t *transport) queueHeaders(ctx context.Context) map[string]string {
+	headers := maps.Clone(t.headers)
+	if t.dsnFile != nil {
+		maps.Copy(headers, t.dsnFile.headers(ctx))
+	}
+	return headers
+}
+
+// signalStats returns the export stats for the signal.
+func (t *transport) signalStats(signal Signal) *exportStats {
+	for _, s := range t.stats {
+		if s.signal == signal {
+			return s
+		}
+	}
+	s := newExportStats(t.dsn.Redacted(), signal)
+	t.stats = append(t.stats, s)
+	return s
+}
+
+// Close stops the disk queue replay and closes the connections.
+// It must be called after the exporters are shut down.
+func (t *transport) Close() error {
+	var lastErr error
+	if t.queue != nil {
+		if err := t.queue.Close(); err != nil {
+			lastErr = err
+		}
+	}
+	if t.grpcConn != nil {
+		if err := t.grpcConn.Close(); err != nil {
+			lastErr = err
+		}
+	}
+	if tr, ok := t.baseTransport.(interface{ CloseIdleConnections() }); ok {
+		tr.CloseIdleConnections()
+	}
+	return lastErr
+}
+
+//------------------------------------------------------------------------------
+
+// headersTransport adds the headers returned by the function to each request.
+type headersTransport struct {
+	headers func(ctx context.Context) map[string]string
+	next    http.RoundTripper
+}
+
+func (t *headersTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	headers := t.headers(req.Context())
+	if len(headers) == 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// headersInterceptor adds the headers returned by the function to each gRPC request
+// replacing the headers with the same keys.
+func headersInterceptor(headers func(ctx context.Context) map[string]string) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		headers := headers(ctx)
+		if len(headers) == 0 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		md, _ := metadata.FromOutgoingContext(ctx)
+		md = md.Copy()
+		for k, v := range headers {
+			md.Set(k, v)
+		}
+		ctx = metadata.NewOutgoingContext(ctx, md)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
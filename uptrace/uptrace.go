@@ -2,6 +2,8 @@ package uptrace
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"strings"
 	"sync/atomic"
@@ -9,62 +11,196 @@ import (
 	"github.com/uptrace/uptrace-go/internal"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/log/global"
 	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/trace"
 )
 
+var (
+	// ErrDisabled is returned by New when Uptrace is disabled either with
+	// UPTRACE_DISABLED env var or by disabling all signals.
+	ErrDisabled = errors.New("uptrace: disabled")
+
+	// ErrDummyDSN is returned by New when the DSN contains the "<token>" placeholder
+	// copied from the documentation.
+	ErrDummyDSN = errors.New("uptrace: dummy DSN")
+
+	// ErrDSNRejected is reported when Uptrace rejects the DSN, for example, because
+	// the token is invalid or the project does not exist.
+	ErrDSNRejected = errors.New("uptrace: DSN is rejected")
+)
+
 // ConfigureOpentelemetry configures OpenTelemetry to export data to Uptrace.
 // By default it:
 //   - creates tracer provider;
 //   - registers Uptrace span exporter;
 //   - sets tracecontext + baggage composite context propagator.
 //
-// You can use UPTRACE_DISABLED env var to completely skip Uptrace configuration.
+// You can use UPTRACE_DISABLED or OTEL_SDK_DISABLED env vars to completely skip
+// Uptrace configuration.
+//
+// Besides UPTRACE_DSN and UPTRACE_DSN_FILE, the standard OTEL_TRACES_SAMPLER, OTEL_PROPAGATORS,
+// OTEL_BSP_*, OTEL_BLRP_*, OTEL_METRIC_EXPORT_INTERVAL, and OTEL_EXPORTER_OTLP_* env vars
+// are supported.
+// Options take precedence over env vars.
+//
+// ConfigureOpentelemetry logs configuration errors using the logger set with SetLogger.
+// Use New if you want to handle the errors yourself.
 func ConfigureOpentelemetry(opts ...Option) {
-	if _, ok := os.LookupEnv("UPTRACE_DISABLED"); ok {
+	client, err := New(context.TODO(), opts...)
+	if err != nil {
+		if !errors.Is(err, ErrDisabled) {
+			internal.Logger.Printf("Uptrace is disabled: %s", err)
+		}
 		return
 	}
+	atomicClient.Store(client)
+}
+
+// New configures OpenTelemetry to export data to Uptrace and returns a client
+// that owns the created providers. Unlike ConfigureOpentelemetry, New returns
+// an error when the configuration is invalid and does not change the client used
+// by the package-level functions such as Shutdown and ReportError.
+//
+// The returned client must be shut down with Client.Shutdown.
+func New(ctx context.Context, opts ...Option) (*Client, error) {
+	if _, ok := os.LookupEnv("UPTRACE_DISABLED"); ok {
+		return nil, ErrDisabled
+	}
 
-	ctx := context.TODO()
-	conf := newConfig(opts)
+	conf, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
 
+	if conf.disabled {
+		return nil, ErrDisabled
+	}
 	if !conf.tracingEnabled && !conf.metricsEnabled && !conf.loggingEnabled {
-		return
+		return nil, ErrDisabled
 	}
 
-	dsn, err := ParseDSN(conf.dsn[0])
-	if err != nil {
-		internal.Logger.Printf("invalid Uptrace DSN: %s (Uptrace is disabled)", err)
-		return
+	var dsns []*DSN
+	if conf.fileExporterConf == nil || len(conf.dsn) > 0 || conf.dsnFilePath != "" {
+		dsns, err = conf.parseDSNs()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	if dsn.Token == "<token>" {
-		internal.Logger.Printf("dummy Uptrace DSN detected: %q (Uptrace is disabled)", conf.dsn)
-		return
+	var client *Client
+	if len(dsns) > 0 {
+		client = newClient(dsns[0])
+	} else {
+		// Only the file exporter is configured.
+		client = newClient(fallbackClient.dsn)
 	}
 
-	if strings.HasSuffix(dsn.Host, ":14318") {
-		internal.Logger.Printf("uptrace-go uses OTLP/gRPC exporter, but got host %q", dsn.Host)
+	if conf.fileExporterConf != nil {
+		exp, err := newFileExporter(conf.fileExporterConf)
+		if err != nil {
+			return nil, err
+		}
+		conf.fileExporter = exp
+		client.fileExporter = exp
 	}
 
-	client := newClient(dsn)
+	for _, dsn := range dsns {
+		t, err := newTransport(conf, dsn)
+		if err != nil {
+			_ = client.Shutdown(ctx)
+			return nil, err
+		}
+		client.transports = append(client.transports, t)
+	}
+	conf.transports = client.transports
+	if conf.dsnMode == DSNFailover && len(conf.transports) > 1 {
+		conf.failover = newFailover(conf)
+		client.failover = conf.failover
+	}
 
-	configurePropagator(conf)
+	client.resource = conf.newResource()
 	if conf.tracingEnabled {
-		client.tp = configureTracing(ctx, conf)
+		client.tp, err = configureTracing(ctx, conf)
+		client.remoteSampler = conf.remoteSampler
+		if err != nil {
+			_ = client.Shutdown(ctx)
+			return nil, err
+		}
+		client.tracer = client.tp.Tracer("uptrace-go")
 	}
 	if conf.metricsEnabled {
-		client.mp = configureMetrics(ctx, conf)
+		client.mp, err = configureMetrics(ctx, conf)
+		if err != nil {
+			_ = client.Shutdown(ctx)
+			return nil, err
+		}
 	}
 	if conf.loggingEnabled {
-		client.lp = configureLogging(ctx, conf)
+		client.lp, err = configureLogging(ctx, conf)
+		if err != nil {
+			_ = client.Shutdown(ctx)
+			return nil, err
+		}
 	}
 
-	atomicClient.Store(client)
+	for _, t := range client.transports {
+		client.stats = append(client.stats, t.stats...)
+	}
+	if client.fileExporter != nil {
+		client.stats = append(client.stats, client.fileExporter.stats...)
+	}
+	if client.mp != nil {
+		if err := client.instrumentStats(client.mp); err != nil {
+			_ = client.Shutdown(ctx)
+			return nil, fmt.Errorf("instrumentStats failed: %w", err)
+		}
+	}
+
+	// The globals are set only when the client is fully configured.
+	client.setGlobals(conf)
+
+	return client, nil
 }
 
-func configurePropagator(conf *config) {
+func (conf *config) parseDSNs() ([]*DSN, error) {
+	if conf.dsnFilePath != "" {
+		f, err := newDSNFile(conf.dsnFilePath)
+		if err != nil {
+			return nil, err
+		}
+		conf.dsnFile = f
+		return []*DSN{f.dsn.Load()}, nil
+	}
+
+	if len(conf.dsn) == 0 {
+		_, err := ParseDSN("")
+		return nil, err
+	}
+
+	dsns := make([]*DSN, len(conf.dsn))
+	for i, str := range conf.dsn {
+		dsn, err := ParseDSN(str)
+		if err != nil {
+			return nil, err
+		}
+		if dsn.Token == "<token>" {
+			return nil, fmt.Errorf("%w: %q", ErrDummyDSN, str)
+		}
+		dsns[i] = dsn
+	}
+	return dsns, nil
+}
+
+// setGlobals registers the propagator and the created providers as the OpenTelemetry globals.
+func (c *Client) setGlobals(conf *config) {
+	if conf.withoutGlobals {
+		return
+	}
+
 	textMapPropagator := conf.textMapPropagator
 	if textMapPropagator == nil {
 		textMapPropagator = propagation.NewCompositeTextMapPropagator(
@@ -73,6 +209,36 @@ func configurePropagator(conf *config) {
 		)
 	}
 	otel.SetTextMapPropagator(textMapPropagator)
+
+	if c.tp != nil && c.tp != conf.tracerProvider {
+		otel.SetTracerProvider(c.tp)
+	}
+	if c.mp != nil {
+		otel.SetMeterProvider(c.mp)
+	}
+	if c.lp != nil {
+		global.SetLoggerProvider(c.lp)
+	}
+}
+
+// newTextMapPropagator creates a composite propagator using the propagator names
+// defined by the OpenTelemetry specification.
+func newTextMapPropagator(names []string) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+	for _, name := range names {
+		switch name = strings.TrimSpace(name); name {
+		case "tracecontext":
+			propagators = append(propagators, propagation.TraceContext{})
+		case "baggage":
+			propagators = append(propagators, propagation.Baggage{})
+		case "none":
+			return propagation.NewCompositeTextMapPropagator(), nil
+		case "":
+		default:
+			return nil, fmt.Errorf("unsupported propagator: %q", name)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
 }
 
 //------------------------------------------------------------------------------
@@ -87,12 +253,12 @@ var (
 	atomicClient atomic.Value
 )
 
-func activeClient() *client {
+func activeClient() *Client {
 	v := atomicClient.Load()
 	if v == nil {
 		return fallbackClient
 	}
-	return v.(*client)
+	return v.(*Client)
 }
 
 func TraceURL(span trace.Span) string {
@@ -116,7 +282,15 @@ func ForceFlush(ctx context.Context) error {
 }
 
 func TracerProvider() *sdktrace.TracerProvider {
-	return activeClient().tp
+	return activeClient().TracerProvider()
+}
+
+func MeterProvider() *sdkmetric.MeterProvider {
+	return activeClient().MeterProvider()
+}
+
+func LoggerProvider() *sdklog.LoggerProvider {
+	return activeClient().LoggerProvider()
 }
 
 // SetLogger sets the logger to the given one.
@@ -4,40 +4,136 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/log/global"
 
 	"github.com/uptrace/uptrace-go/uptrace"
 )
 
 func TestInvalidDSN(t *testing.T) {
-	t.Skip("overwrites global tracer provider")
-
 	var logger Logger
 	uptrace.SetLogger(&logger)
 
 	uptrace.ConfigureOpentelemetry(uptrace.WithDSN("dsn"))
 
 	require.Equal(t,
-		`Uptrace is disabled: DSN="dsn" does not have a token`,
+		`Uptrace is disabled: DSN="dsn" does not have a scheme`,
 		logger.Message())
 }
 
-func TestUnknownToken(t *testing.T) {
-	t.Skip("overwrites global tracer provider")
-
+func TestNewErrors(t *testing.T) {
 	ctx := context.Background()
 
-	var logger Logger
-	uptrace.SetLogger(&logger)
+	_, err := uptrace.New(ctx, uptrace.WithDSN("dsn"))
+	require.Error(t, err)
+	require.Equal(t, `DSN="dsn" does not have a scheme`, err.Error())
+
+	_, err = uptrace.New(ctx, uptrace.WithDSN("https://%3Ctoken%3E@uptrace.dev/1"))
+	require.ErrorIs(t, err, uptrace.ErrDummyDSN)
 
-	uptrace.ConfigureOpentelemetry(uptrace.WithDSN("https://UNKNOWN@uptrace.dev/2"))
+	_, err = uptrace.New(ctx,
+		uptrace.WithDSN("https://token@uptrace.dev/1"),
+		uptrace.WithTracingDisabled(),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+	)
+	require.ErrorIs(t, err, uptrace.ErrDisabled)
 
-	uptrace.ReportError(ctx, errors.New("hello"))
-	err := uptrace.Shutdown(ctx)
+	t.Setenv("UPTRACE_DSN", "")
+	_, err = uptrace.New(ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "DSN is empty")
+}
+
+func TestUnknownToken(t *testing.T) {
+	ctx := context.Background()
+
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests.Add(1)
+		http.Error(w, `project with token="UNKNOWN" doesn't exist`, http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	var reported []error
+	client, err := uptrace.New(ctx,
+		uptrace.WithDSN(strings.Replace(srv.URL, "http://", "http://UNKNOWN@", 1)+"/2"),
+		uptrace.WithMetricsDisabled(),
+		uptrace.WithLoggingDisabled(),
+		uptrace.WithoutGlobals(),
+		uptrace.WithErrorHandler(func(err error) {
+			reported = append(reported, err)
+		}),
+	)
+	require.NoError(t, err)
+
+	defer client.Shutdown(ctx)
+
+	require.NoError(t, client.Status())
+
+	client.ReportError(ctx, errors.New("hello"))
+	err = client.ForceFlush(ctx)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), `project with token="UNKNOWN" doesn't exist`)
+	require.Equal(t, int64(1), requests.Load())
+
+	client.ReportError(ctx, errors.New("hello"))
+	err = client.ForceFlush(ctx)
+	require.ErrorIs(t, err, uptrace.ErrDSNRejected)
+	require.Equal(t, int64(1), requests.Load())
+
+	require.Len(t, reported, 1)
+	require.ErrorIs(t, reported[0], uptrace.ErrDSNRejected)
+	require.Contains(t, reported[0].Error(), `project with token="UNKNOWN" doesn't exist`)
+
+	err = client.Status()
+	require.ErrorIs(t, err, uptrace.ErrDSNRejected)
+	require.Contains(t, err.Error(), "403 Forbidden")
+}
+
+func TestWithoutGlobals(t *testing.T) {
+	ctx := context.Background()
+
+	client, err := uptrace.New(ctx,
+		uptrace.WithDSN("http://token@localhost:14318/1"),
+		uptrace.WithoutGlobals(),
+	)
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	require.NotNil(t, client.TracerProvider())
+	require.NotNil(t, client.MeterProvider())
+	require.NotNil(t, client.LoggerProvider())
+
+	require.NotEqual(t, client.TracerProvider(), otel.GetTracerProvider())
+	require.NotEqual(t, client.MeterProvider(), otel.GetMeterProvider())
+	require.NotEqual(t, client.LoggerProvider(), global.GetLoggerProvider())
+}
+
+func TestGlobals(t *testing.T) {
+	ctx := context.Background()
+
+	tp, mp, lp := otel.GetTracerProvider(), otel.GetMeterProvider(), global.GetLoggerProvider()
+	defer func() {
+		otel.SetTracerProvider(tp)
+		otel.SetMeterProvider(mp)
+		global.SetLoggerProvider(lp)
+	}()
+
+	client, err := uptrace.New(ctx, uptrace.WithDSN("http://token@localhost:14318/1"))
+	require.NoError(t, err)
+	defer client.Shutdown(ctx)
+
+	require.Equal(t, client.TracerProvider(), otel.GetTracerProvider())
+	require.Equal(t, client.MeterProvider(), otel.GetMeterProvider())
+	require.Equal(t, client.LoggerProvider(), global.GetLoggerProvider())
 }
 
 //------------------------------------------------------------------------------